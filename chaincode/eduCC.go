@@ -6,14 +6,46 @@ package main
 
 import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/protos/peer"
 	"encoding/json"
+	"encoding/hex"
+	"encoding/base64"
+	"encoding/asn1"
+	"encoding/pem"
+	"crypto/sha256"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"math/big"
 	"fmt"
 	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 const DOC_TYPE = "eduObj"
 
+// 承诺摘要到身份证号的索引
+const COMMIT_INDEX = "commitment"
+
+// 生成加盐哈希承诺的字段, 照片地址只在系统内部有意义, 不生成承诺
+var commitFields = []string{"Name", "Gender", "Nation", "EntityID", "Place", "BirthDay", "EnrollDate", "GraduationDate",
+	"SchoolName", "Major", "QuaType", "Length", "Mode", "Level", "Graduation", "CertNo"}
+
+// 签名证书中登记所属学校的属性, 由 fabric-ca 写入证书
+const SCHOOL_ATTR = "edu.school"
+
+// 为 Web 账号注册的身份在证书中登记账号的属性, 账号身份不能吊销证书
+const ACCOUNT_ATTR = "edu.account"
+
+// 已吊销证书的索引: AKI、序列号(十六进制)
+const REVOKED_CERT_INDEX = "revokedCert"
+
+// 学校签名的字段: 承诺字段及照片地址
+var signedFields = append(append([]string{}, commitFields...), "Photo")
+
 // 保存edu
 // args: education
 func PutEdu(stub shim.ChaincodeStubInterface, edu Education) ([]byte, bool) {
@@ -113,6 +145,22 @@ func (t *EducationChaincode) addEdu(stub shim.ChaincodeStubInterface, args []str
 		return shim.Error("要添加的身份证号码已存在")
 	}
 
+	// 撤销标记只能通过 revokeEdu 设置
+	edu.Revoked = false
+	edu.RevokeReason = ""
+	edu.RevokedAt = ""
+	edu.RevokedBy = ""
+
+	err = verifyEduSignature(stub, edu)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = commitEdu(stub, &edu)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	_, bl := PutEdu(stub, edu)
 	if !bl {
 		return shim.Error("保存信息时发生错误")
@@ -137,11 +185,16 @@ func (t *EducationChaincode) queryEduByCertNoAndName(stub shim.ChaincodeStubInte
 	name := args[1]
 
 	// 拼装CouchDB所需要的查询字符串(是标准的一个JSON串)
-	// queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"eduObj\", \"CertNo\":\"%s\"}}", CertNo)
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\", \"CertNo\":\"%s\", \"Name\":\"%s\"}}", DOC_TYPE, CertNo, name)
+	// 参数经 JSON 编码后拼入, 避免参数中的引号等字符改变查询条件
+	query, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]string{"docType": DOC_TYPE, "CertNo": CertNo, "Name": name},
+	})
+	if err != nil {
+		return shim.Error("拼装查询条件时发生错误")
+	}
 
 	// 查询数据
-	result, err := getEduByQueryString(stub, queryString)
+	result, err := getEduByQueryString(stub, string(query))
 	if err != nil {
 		return shim.Error("根据证书编号及姓名查询信息时发生错误")
 	}
@@ -184,13 +237,15 @@ func (t *EducationChaincode) queryEduInfoByEntityID(stub shim.ChaincodeStubInter
 
 	// 迭代处理
 	var historys []HistoryItem
-	var hisEdu Education
 	for iterator.HasNext() {
 		hisData, err := iterator.Next()
 		if err != nil {
 			return shim.Error("获取edu的历史变更数据失败")
 		}
 
+		// 每条历史记录单独反序列化, 避免上一条记录的字段(如撤销标记)残留
+		var hisEdu Education
+
 		var historyItem HistoryItem
 		historyItem.TxId = hisData.TxId
 		json.Unmarshal(hisData.Value, &hisEdu)
@@ -234,6 +289,13 @@ func (t *EducationChaincode) updateEdu(stub shim.ChaincodeStubInterface, args []
 	if !bl{
 		return shim.Error("根据身份证号码查询信息时发生错误")
 	}
+	if result.Revoked {
+		return shim.Error("信息已撤销, 不能修改")
+	}
+	// 签名证书须属于信息中的学校, 不允许将其他学校的信息改为本校
+	if result.SchoolName != info.SchoolName {
+		return shim.Error("不能修改信息所属的学校")
+	}
 
 	result.Name = info.Name
 	result.BirthDay = info.BirthDay
@@ -254,6 +316,19 @@ func (t *EducationChaincode) updateEdu(stub shim.ChaincodeStubInterface, args []
 	result.Level = info.Level
 	result.Graduation = info.Graduation
 	result.CertNo = info.CertNo;
+	result.SaltNonce = info.SaltNonce
+	result.Signature = info.Signature
+	result.SignerCert = info.SignerCert
+
+	err = verifyEduSignature(stub, result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = commitEdu(stub, &result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	_, bl = PutEdu(stub, result)
 	if !bl {
@@ -275,12 +350,18 @@ func (t *EducationChaincode) delEdu(stub shim.ChaincodeStubInterface, args []str
 		return shim.Error("给定的参数个数不符合要求")
 	}
 
-	/*var edu Education
-	result, bl := GetEduInfo(stub, info.EntityID)
-	err := json.Unmarshal(result, &edu)
-	if err != nil {
-		return shim.Error("反序列化信息时发生错误")
-	}*/
+	// 已撤销的信息不能删除, 否则删除后可重新添加, 撤销将被绕过
+	edu, bl := GetEduInfo(stub, args[0])
+	if !bl {
+		return shim.Error("根据身份证号码没有查询到相关的信息")
+	}
+	if edu.Revoked {
+		return shim.Error("信息已撤销, 不能删除")
+	}
+	// 只能删除本校的信息
+	if _, err := checkSchool(stub, edu.SchoolName); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	err := stub.DelState(args[0])
 	if err != nil {
@@ -294,3 +375,392 @@ func (t *EducationChaincode) delEdu(stub shim.ChaincodeStubInterface, args []str
 
 	return shim.Success([]byte("信息删除成功"))
 }
+
+// 根据身份证号撤销信息: 信息仍保留在账本中并标记为已撤销, 撤销后不能再修改
+// args: entityID, reason
+func (t *EducationChaincode) revokeEdu(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 3{
+		return shim.Error("给定的参数个数不符合要求")
+	}
+
+	reason := strings.TrimSpace(args[1])
+	if reason == "" {
+		return shim.Error("撤销原因不能为空")
+	}
+
+	edu, bl := GetEduInfo(stub, args[0])
+	if !bl {
+		return shim.Error("根据身份证号码没有查询到相关的信息")
+	}
+	if edu.Revoked {
+		return shim.Error("信息已撤销")
+	}
+	// 只能撤销本校的信息
+	creator, err := checkSchool(stub, edu.SchoolName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// 以交易时间作为撤销时间, 各背书节点的结果一致
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("获取交易时间失败")
+	}
+
+	edu.Revoked = true
+	edu.RevokeReason = reason
+	edu.RevokedBy = creatorName(stub, creator)
+	edu.RevokedAt = time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339)
+
+	_, bl = PutEdu(stub, edu)
+	if !bl {
+		return shim.Error("保存信息时发生错误")
+	}
+
+	err = stub.SetEvent(args[2], []byte{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte("信息撤销成功"))
+}
+
+// 查询账本中引用的全部照片地址(含历史版本), 供清理未引用的照片文件
+// args: 无
+func (t *EducationChaincode) queryPhotos(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 0 {
+		return shim.Error("给定的参数个数不符合要求")
+	}
+
+	iterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return shim.Error("查询信息列表失败")
+	}
+	defer iterator.Close()
+
+	photos := make(map[string]bool)
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return shim.Error("查询信息列表失败")
+		}
+
+		his, err := stub.GetHistoryForKey(kv.Key)
+		if err != nil {
+			return shim.Error("查询历史变更数据失败")
+		}
+		for his.HasNext() {
+			hisData, err := his.Next()
+			if err != nil {
+				his.Close()
+				return shim.Error("查询历史变更数据失败")
+			}
+
+			var edu Education
+			if json.Unmarshal(hisData.Value, &edu) == nil && edu.Photo != "" {
+				photos[edu.Photo] = true
+			}
+		}
+		his.Close()
+	}
+
+	list := []string{}
+	for photo := range photos {
+		list = append(list, photo)
+	}
+	sort.Strings(list)
+
+	result, err := json.Marshal(list)
+	if err != nil {
+		return shim.Error("序列化照片列表时发生错误")
+	}
+	return shim.Success(result)
+}
+
+// 根据 transient 中的盐值为各字段生成承诺, 并记录承诺摘要到身份证号的索引
+// 盐值只经由 transient 传入, 不会写入交易及账本; 未提供盐值时不生成承诺
+func commitEdu(stub shim.ChaincodeStubInterface, edu *Education) error {
+	edu.Commitments = nil
+	edu.CommitRoot = ""
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return fmt.Errorf("读取 transient 数据时发生错误")
+	}
+	b, ok := transient["salts"]
+	if !ok {
+		return nil
+	}
+
+	var salts map[string]string
+	err = json.Unmarshal(b, &salts)
+	if err != nil {
+		return fmt.Errorf("反序列化盐值时发生错误")
+	}
+
+	commitments := make(map[string]string)
+	for _, name := range commitFields {
+		salt, err := hex.DecodeString(salts[name])
+		if err != nil || len(salt) != 32 {
+			return fmt.Errorf("字段 %s 的盐值无效", name)
+		}
+		value := reflect.ValueOf(*edu).FieldByName(name).String()
+		commitments[name] = commitment(salts[name], name, value)
+	}
+	edu.Commitments = commitments
+	edu.CommitRoot = commitmentRoot(commitments)
+
+	key, err := stub.CreateCompositeKey(COMMIT_INDEX, []string{edu.CommitRoot})
+	if err != nil {
+		return fmt.Errorf("创建承诺索引时发生错误")
+	}
+	err = stub.PutState(key, []byte(edu.EntityID))
+	if err != nil {
+		return fmt.Errorf("保存承诺索引时发生错误")
+	}
+	return nil
+}
+
+// 字段的承诺: SHA-256(盐值(十六进制) + ":" + 字段名 + ":" + 字段值) 的十六进制
+func commitment(salt, name, value string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + name + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// 承诺摘要: 按字段名排序的 "字段名:承诺" 以换行连接后的 SHA-256
+func commitmentRoot(commitments map[string]string) string {
+	names := make([]string, 0, len(commitments))
+	for name := range commitments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ":" + commitments[name]
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// 信息的规范化序列化: 以签名字段为键、按键排序的紧凑 JSON 对象, 不转义 HTML 字符
+func canonicalEdu(edu Education) []byte {
+	fields := make(map[string]string)
+	for _, name := range signedFields {
+		fields[name] = reflect.ValueOf(edu).FieldByName(name).String()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(fields)
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// 核验学校对信息的签名: 签名证书必须是提交交易的身份, 签名为规范化序列化 SHA-256 摘要的 ECDSA 签名
+// 交易提交者的证书已由 Peer 按通道 MSP 核验, 因此签名证书可追溯到学校的 CA
+func verifyEduSignature(stub shim.ChaincodeStubInterface, edu Education) error {
+	if edu.Signature == "" || edu.SignerCert == "" {
+		return fmt.Errorf("信息缺少学校签名")
+	}
+
+	block, _ := pem.Decode([]byte(edu.SignerCert))
+	if block == nil {
+		return fmt.Errorf("签名证书格式错误")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析签名证书时发生错误")
+	}
+	// 签名证书须由 fabric-ca 登记了所属学校, 且与信息中的学校一致
+	creator, err := checkSchool(stub, edu.SchoolName)
+	if err != nil {
+		return err
+	}
+	if !creator.Equal(cert) {
+		return fmt.Errorf("签名证书与交易提交者不一致")
+	}
+
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("签名证书不是 ECDSA 证书")
+	}
+	der, err := base64.StdEncoding.DecodeString(edu.Signature)
+	if err != nil {
+		return fmt.Errorf("签名格式错误")
+	}
+	var sig struct {
+		R, S	*big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return fmt.Errorf("签名格式错误")
+	}
+	digest := sha256.Sum256(canonicalEdu(edu))
+	if !ecdsa.Verify(pub, digest[:], sig.R, sig.S) {
+		return fmt.Errorf("学校签名与信息不一致")
+	}
+	return nil
+}
+
+// 读取交易提交者的证书, 证书已记录为吊销时返回错误
+// 通道 MSP 未配置 CRL 时 Peer 仍接受已在 fabric-ca 吊销的证书, 由链码拒绝其写入
+func checkCreator(stub shim.ChaincodeStubInterface) (*x509.Certificate, error) {
+	creator, err := cid.GetX509Certificate(stub)
+	if err != nil || creator == nil {
+		return nil, fmt.Errorf("读取交易提交者证书时发生错误")
+	}
+	key, err := revokedCertKey(stub, hex.EncodeToString(creator.AuthorityKeyId), creator.SerialNumber.Text(16))
+	if err != nil {
+		return nil, err
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("查询证书吊销记录时发生错误")
+	}
+	if b != nil {
+		return nil, fmt.Errorf("交易提交者的证书已被吊销")
+	}
+	return creator, nil
+}
+
+// 交易提交者的证书须未被吊销, 且由 fabric-ca 登记的所属学校与 school 一致, 返回提交者的证书
+func checkSchool(stub shim.ChaincodeStubInterface, school string) (*x509.Certificate, error) {
+	creator, err := checkCreator(stub)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := cid.GetAttributeValue(stub, SCHOOL_ATTR)
+	if err != nil {
+		return nil, fmt.Errorf("读取提交者证书的学校属性时发生错误")
+	}
+	if !found || value != school {
+		return nil, fmt.Errorf("交易提交者不属于学校 %s", school)
+	}
+	return creator, nil
+}
+
+// 交易提交者的名称: 账号身份为证书中登记的账号, 否则为证书的 CN
+func creatorName(stub shim.ChaincodeStubInterface, creator *x509.Certificate) string {
+	if account, found, err := cid.GetAttributeValue(stub, ACCOUNT_ATTR); err == nil && found {
+		return account
+	}
+	return creator.Subject.CommonName
+}
+
+// 已吊销证书的键, AKI 及序列号统一为小写且不含前导零的十六进制
+func revokedCertKey(stub shim.ChaincodeStubInterface, aki, serial string) (string, error) {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(serial), "0x"), 16)
+	if aki == "" || !ok {
+		return "", fmt.Errorf("证书的 AKI 或序列号格式错误")
+	}
+	key, err := stub.CreateCompositeKey(REVOKED_CERT_INDEX, []string{strings.ToLower(aki), n.Text(16)})
+	if err != nil {
+		return "", fmt.Errorf("创建证书吊销索引时发生错误")
+	}
+	return key, nil
+}
+
+// 记录已在 fabric-ca 吊销的证书, 此后该证书提交的添加、修改及撤销均被拒绝
+// 只能由同一 CA 签发的非账号身份(如组织的服务身份)调用; 重复记录时直接返回成功
+// args: aki, serial, reason
+func (t *EducationChaincode) revokeCert(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 3 {
+		return shim.Error("给定的参数个数不符合要求")
+	}
+
+	creator, err := checkCreator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, isAccount, err := cid.GetAttributeValue(stub, ACCOUNT_ATTR); err != nil || isAccount {
+		return shim.Error("账号身份不能吊销证书")
+	}
+	if !strings.EqualFold(hex.EncodeToString(creator.AuthorityKeyId), args[0]) {
+		return shim.Error("只能吊销与调用者同一 CA 签发的证书")
+	}
+
+	key, err := revokedCertKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("查询证书吊销记录时发生错误")
+	}
+	if b != nil {
+		return shim.Success([]byte("证书已吊销"))
+	}
+
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("获取交易时间失败")
+	}
+	record := RevokedCert{
+		AKI: strings.ToLower(args[0]),
+		Serial: args[1],
+		Reason: args[2],
+		RevokedAt: time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339),
+		RevokedBy: creator.Subject.CommonName,
+	}
+	b, err = json.Marshal(record)
+	if err != nil {
+		return shim.Error("序列化吊销记录时发生错误")
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return shim.Error("保存吊销记录时发生错误")
+	}
+	return shim.Success([]byte("证书吊销成功"))
+}
+
+// 根据承诺摘要查询各字段的承诺及信息的当前状态, 供核验持证人出示的部分信息
+// args: root
+func (t *EducationChaincode) queryCommitments(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("给定的参数个数不符合要求")
+	}
+
+	key, err := stub.CreateCompositeKey(COMMIT_INDEX, []string{args[0]})
+	if err != nil {
+		return shim.Error("创建承诺索引时发生错误")
+	}
+	entityID, err := stub.GetState(key)
+	if err != nil || entityID == nil {
+		return shim.Error("根据承诺摘要没有查询到相关的信息")
+	}
+
+	edu, bl := GetEduInfo(stub, string(entityID))
+	if !bl {
+		return shim.Error("根据承诺摘要没有查询到相关的信息")
+	}
+
+	record := CommitmentRecord{Root: args[0], Current: edu.CommitRoot == args[0], Revoked: edu.Revoked, RevokedAt: edu.RevokedAt}
+
+	// 在历史记录中查找生成该组承诺的版本
+	his, err := stub.GetHistoryForKey(string(entityID))
+	if err != nil {
+		return shim.Error("查询历史变更数据失败")
+	}
+	defer his.Close()
+	for his.HasNext() {
+		hisData, err := his.Next()
+		if err != nil {
+			return shim.Error("查询历史变更数据失败")
+		}
+
+		var version Education
+		if json.Unmarshal(hisData.Value, &version) == nil && version.CommitRoot == args[0] && record.TxID == "" {
+			record.Commitments = version.Commitments
+			record.TxID = hisData.TxId
+		}
+	}
+	if record.Commitments == nil {
+		return shim.Error("根据承诺摘要没有查询到相关的信息")
+	}
+
+	result, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error("序列化承诺时发生错误")
+	}
+	return shim.Success(result)
+}
@@ -0,0 +1,450 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/golang/protobuf/proto"
+	"encoding/json"
+	"encoding/hex"
+	"encoding/base64"
+	"encoding/asn1"
+	"encoding/pem"
+	"crypto/sha256"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MockStub 不支持 transient 及交易提交者, 由测试指定
+type testStub struct {
+	*shim.MockStub
+	creator	[]byte
+	transient	map[string][]byte
+	txs	int
+}
+
+func newTestStub() *testStub {
+	return &testStub{MockStub: shim.NewMockStub("education", new(EducationChaincode))}
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// 在一个模拟交易中执行
+func (s *testStub) run(f func(stub shim.ChaincodeStubInterface) error) error {
+	s.txs++
+	txID := fmt.Sprintf("tx%d", s.txs)
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	return f(s)
+}
+
+// 以指定身份提交交易
+func (s *testStub) invoke(id *testIdentity, fn func(shim.ChaincodeStubInterface, []string) peer.Response, args ...string) peer.Response {
+	s.creator = id.creator
+	var resp peer.Response
+	s.run(func(stub shim.ChaincodeStubInterface) error {
+		resp = fn(stub, args)
+		return nil
+	})
+	return resp
+}
+
+// 由同一 CA 签发的测试身份, 证书中以 fabric-ca 的方式登记属性
+type testIdentity struct {
+	key	*ecdsa.PrivateKey
+	cert	*x509.Certificate
+	pem	string
+	creator	[]byte
+}
+
+var testAKI = []byte{0x0a, 0x0b, 0x0c, 0x0d}
+
+func newTestIdentity(t *testing.T, serial int64, attrs map[string]string) *testIdentity {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject: pkix.Name{CommonName: fmt.Sprintf("user%d", serial)},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		AuthorityKeyId: testAKI,
+	}
+	if attrs != nil {
+		b, err := json.Marshal(map[string]map[string]string{"attrs": attrs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: b}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org1MSP", IdBytes: certPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{key: key, cert: cert, pem: string(certPEM), creator: creator}
+}
+
+// 对信息的规范化序列化签名, 返回序列化后的信息
+func (id *testIdentity) sign(t *testing.T, edu Education) string {
+	edu.SignerCert = id.pem
+	digest := sha256.Sum256(canonicalEdu(edu))
+	r, s, err := ecdsa.Sign(rand.Reader, id.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edu.Signature = base64.StdEncoding.EncodeToString(der)
+
+	b, err := json.Marshal(edu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func testEdu() Education {
+	return Education{
+		Name: "张小三",
+		Gender: "男",
+		Nation: "汉",
+		EntityID: "101101010101010101",
+		Place: "北京",
+		BirthDay: "1991年01月01日",
+		EnrollDate: "2009年9月",
+		GraduationDate: "2013年7月",
+		SchoolName: "中国政法大学",
+		Major: "民商法学",
+		QuaType: "普通",
+		Length: "四年",
+		Mode: "普通全日制",
+		Level: "本科",
+		Graduation: "毕业",
+		CertNo: "11111111111111",
+		Photo: "/static/photo/11.png",
+	}
+}
+
+// 各字段的盐值, 与服务端派生的格式一致(32 字节的十六进制)
+func testSalts() map[string]string {
+	salts := make(map[string]string)
+	for _, name := range commitFields {
+		sum := sha256.Sum256([]byte("salt:" + name))
+		salts[name] = hex.EncodeToString(sum[:])
+	}
+	return salts
+}
+
+func saltsTransient(t *testing.T, salts map[string]string) map[string][]byte {
+	b, err := json.Marshal(salts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][]byte{"salts": b}
+}
+
+// 与服务端测试相同的向量, 两端的算法须保持一致
+func TestCommitmentVectors(t *testing.T) {
+	if got := commitment("00", "Name", "张小三"); got != "cf7e6123427aa66bab352d9a8763aac2734bc7b433f12f273aeb5b4990d451af" {
+		t.Fatalf("commitment() = %s", got)
+	}
+	if got := commitmentRoot(map[string]string{"Name": "1", "CertNo": "2"}); got != "88908570ad71e3133f990d9c4d9ca33eb78811039f6da36709f364630b552570" {
+		t.Fatalf("commitmentRoot() = %s", got)
+	}
+	sum := sha256.Sum256(canonicalEdu(testEdu()))
+	if got := hex.EncodeToString(sum[:]); got != "8cc97294c7441f1af7e64690800d4fb3207c398055efd23fa35e9d11620e599b" {
+		t.Fatalf("canonicalEdu() 的摘要为 %s", got)
+	}
+}
+
+func TestCommitEdu(t *testing.T) {
+	stub := newTestStub()
+	stub.transient = saltsTransient(t, testSalts())
+
+	edu := testEdu()
+	if err := stub.run(func(s shim.ChaincodeStubInterface) error { return commitEdu(s, &edu) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(edu.Commitments) != len(commitFields) {
+		t.Fatalf("生成了 %d 个承诺, 应为 %d", len(edu.Commitments), len(commitFields))
+	}
+	if _, ok := edu.Commitments["Photo"]; ok {
+		t.Fatalf("照片地址不应生成承诺")
+	}
+
+	// 持证人出示字段值及盐值后可重算承诺及摘要
+	salts := testSalts()
+	for _, name := range commitFields {
+		if got := commitment(salts[name], name, fieldValue(edu, name)); got != edu.Commitments[name] {
+			t.Fatalf("字段 %s 的承诺无法由盐值重算", name)
+		}
+	}
+	if commitmentRoot(edu.Commitments) != edu.CommitRoot {
+		t.Fatalf("承诺摘要无法由承诺重算")
+	}
+	key, _ := stub.CreateCompositeKey(COMMIT_INDEX, []string{edu.CommitRoot})
+	if string(stub.State[key]) != edu.EntityID {
+		t.Fatalf("承诺摘要索引未指向身份证号")
+	}
+
+	// 任一字段被修改后承诺摘要随之变化
+	for _, name := range commitFields {
+		tampered := testEdu()
+		setField(&tampered, name, fieldValue(tampered, name)+"x")
+		if err := stub.run(func(s shim.ChaincodeStubInterface) error { return commitEdu(s, &tampered) }); err != nil {
+			t.Fatal(err)
+		}
+		if tampered.CommitRoot == edu.CommitRoot {
+			t.Fatalf("修改字段 %s 后承诺摘要未变化", name)
+		}
+	}
+}
+
+func TestCommitEduSalts(t *testing.T) {
+	short := testSalts()
+	short["Name"] = "abcd"
+	missing := testSalts()
+	delete(missing, "CertNo")
+	notHex := testSalts()
+	notHex["Major"] = "zz" + notHex["Major"][2:]
+
+	tests := []struct {
+		name	string
+		transient	map[string][]byte
+		commit	bool
+		ok	bool
+	}{
+		{"未提供盐值", nil, false, true},
+		{"盐值完整", saltsTransient(t, testSalts()), true, true},
+		{"盐值过短", saltsTransient(t, short), false, false},
+		{"缺少字段的盐值", saltsTransient(t, missing), false, false},
+		{"盐值不是十六进制", saltsTransient(t, notHex), false, false},
+		{"盐值格式错误", map[string][]byte{"salts": []byte("[]")}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newTestStub()
+			stub.transient = tt.transient
+
+			edu := testEdu()
+			// 客户端传入的承诺不被采用
+			edu.Commitments = map[string]string{"Name": "forged"}
+			edu.CommitRoot = "forged"
+			err := stub.run(func(s shim.ChaincodeStubInterface) error { return commitEdu(s, &edu) })
+			if (err == nil) != tt.ok {
+				t.Fatalf("commitEdu() 错误为 %v", err)
+			}
+			if tt.ok && (edu.CommitRoot != "") != tt.commit {
+				t.Fatalf("承诺摘要为 %q", edu.CommitRoot)
+			}
+			if edu.CommitRoot == "forged" {
+				t.Fatalf("采用了客户端传入的承诺")
+			}
+		})
+	}
+}
+
+func TestCanonicalEdu(t *testing.T) {
+	edu := testEdu()
+	want := canonicalEdu(edu)
+
+	var fields map[string]string
+	if err := json.Unmarshal(want, &fields); err != nil {
+		t.Fatalf("规范化序列化不是 JSON 对象: %v", err)
+	}
+	if len(fields) != len(signedFields) || fields["Photo"] != edu.Photo {
+		t.Fatalf("规范化序列化的字段错误: %s", want)
+	}
+
+	// 链码写入的字段不参与签名
+	written := edu
+	written.Revoked = true
+	written.RevokeReason = "原因"
+	written.CommitRoot = "root"
+	written.Signature = "sig"
+	if string(canonicalEdu(written)) != string(want) {
+		t.Fatalf("链码写入的字段影响了规范化序列化")
+	}
+
+	// 任一签名字段被修改后规范化序列化随之变化
+	for _, name := range signedFields {
+		tampered := testEdu()
+		setField(&tampered, name, fieldValue(tampered, name)+"<&>")
+		if string(canonicalEdu(tampered)) == string(want) {
+			t.Fatalf("修改字段 %s 后规范化序列化未变化", name)
+		}
+	}
+}
+
+func fieldValue(edu Education, name string) string {
+	return reflect.ValueOf(edu).FieldByName(name).String()
+}
+
+func setField(edu *Education, name, value string) {
+	reflect.ValueOf(edu).Elem().FieldByName(name).SetString(value)
+}
+
+func TestAddEduSignature(t *testing.T) {
+	school := newTestIdentity(t, 1, map[string]string{SCHOOL_ATTR: "中国政法大学", ACCOUNT_ATTR: "registrar"})
+	other := newTestIdentity(t, 2, map[string]string{SCHOOL_ATTR: "北京大学", ACCOUNT_ATTR: "other"})
+	colleague := newTestIdentity(t, 3, map[string]string{SCHOOL_ATTR: "中国政法大学", ACCOUNT_ATTR: "colleague"})
+	noAttr := newTestIdentity(t, 4, nil)
+
+	edu := testEdu()
+	tampered := func(signed string) string {
+		return strings.Replace(signed, "民商法学", "法学", 1)
+	}
+	unsigned, _ := json.Marshal(edu)
+
+	tests := []struct {
+		name	string
+		creator	*testIdentity
+		arg	string
+		ok	bool
+	}{
+		{"本校身份签名", school, school.sign(t, edu), true},
+		{"缺少签名", school, string(unsigned), false},
+		{"签名后信息被修改", school, tampered(school.sign(t, edu)), false},
+		{"其他学校的身份", other, other.sign(t, edu), false},
+		{"证书未登记学校", noAttr, noAttr.sign(t, edu), false},
+		{"签名者与提交者不一致", colleague, school.sign(t, edu), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newTestStub()
+			resp := stub.invoke(tt.creator, new(EducationChaincode).addEdu, tt.arg, "event")
+			if (resp.Status == shim.OK) != tt.ok {
+				t.Fatalf("addEdu() = %d %s", resp.Status, resp.Message)
+			}
+			if _, exist := GetEduInfo(stub, edu.EntityID); exist != tt.ok {
+				t.Fatalf("信息是否已保存: %v", exist)
+			}
+		})
+	}
+}
+
+func TestRevokeEduSchool(t *testing.T) {
+	school := newTestIdentity(t, 1, map[string]string{SCHOOL_ATTR: "中国政法大学", ACCOUNT_ATTR: "registrar"})
+	other := newTestIdentity(t, 2, map[string]string{SCHOOL_ATTR: "北京大学", ACCOUNT_ATTR: "other"})
+	noAttr := newTestIdentity(t, 3, nil)
+	cc := new(EducationChaincode)
+
+	tests := []struct {
+		name	string
+		creator	*testIdentity
+		ok	bool
+	}{
+		{"本校身份", school, true},
+		{"其他学校的身份", other, false},
+		{"证书未登记学校", noAttr, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newTestStub()
+			if resp := stub.invoke(school, cc.addEdu, school.sign(t, testEdu()), "event"); resp.Status != shim.OK {
+				t.Fatalf("addEdu() = %s", resp.Message)
+			}
+
+			resp := stub.invoke(tt.creator, cc.revokeEdu, testEdu().EntityID, "证书信息有误", "event")
+			if (resp.Status == shim.OK) != tt.ok {
+				t.Fatalf("revokeEdu() = %d %s", resp.Status, resp.Message)
+			}
+			edu, _ := GetEduInfo(stub, testEdu().EntityID)
+			if edu.Revoked != tt.ok {
+				t.Fatalf("信息的撤销标记为 %v", edu.Revoked)
+			}
+			if tt.ok && (edu.RevokedBy != "registrar" || edu.RevokedAt == "") {
+				t.Fatalf("撤销者为 %q, 撤销时间为 %q", edu.RevokedBy, edu.RevokedAt)
+			}
+
+			// 其他学校的身份也不能删除信息
+			if tt.ok {
+				return
+			}
+			if resp := stub.invoke(tt.creator, cc.delEdu, testEdu().EntityID, "event"); resp.Status == shim.OK {
+				t.Fatalf("delEdu() 删除了其他学校的信息")
+			}
+		})
+	}
+}
+
+func TestRevokeCert(t *testing.T) {
+	school := newTestIdentity(t, 1, map[string]string{SCHOOL_ATTR: "中国政法大学", ACCOUNT_ATTR: "registrar"})
+	admin := newTestIdentity(t, 2, nil)
+	serial := school.cert.SerialNumber.Text(16)
+	aki := hex.EncodeToString(testAKI)
+	cc := new(EducationChaincode)
+
+	tests := []struct {
+		name	string
+		creator	*testIdentity
+		args	[]string
+		ok	bool
+	}{
+		{"账号身份不能吊销", school, []string{aki, serial, "离职"}, false},
+		{"不同 CA 的证书", admin, []string{"ffff", serial, "离职"}, false},
+		{"序列号格式错误", admin, []string{aki, "xyz", "离职"}, false},
+		{"服务身份吊销", admin, []string{aki, serial, "离职"}, true},
+		{"AKI 大写且序列号有前导零", admin, []string{strings.ToUpper(aki), "000" + serial, "离职"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newTestStub()
+			if resp := stub.invoke(school, cc.addEdu, school.sign(t, testEdu()), "event"); resp.Status != shim.OK {
+				t.Fatalf("addEdu() = %s", resp.Message)
+			}
+
+			resp := stub.invoke(tt.creator, cc.revokeCert, tt.args...)
+			if (resp.Status == shim.OK) != tt.ok {
+				t.Fatalf("revokeCert() = %d %s", resp.Status, resp.Message)
+			}
+			if tt.ok {
+				// 重复记录时直接返回成功
+				if resp := stub.invoke(tt.creator, cc.revokeCert, tt.args...); resp.Status != shim.OK {
+					t.Fatalf("重复吊销失败: %s", resp.Message)
+				}
+			}
+
+			// 证书吊销后, 其提交的修改及撤销均被拒绝
+			edu := testEdu()
+			edu.Major = "法学"
+			update := stub.invoke(school, cc.updateEdu, school.sign(t, edu), "event")
+			revoke := stub.invoke(school, cc.revokeEdu, edu.EntityID, "证书信息有误", "event")
+			if (update.Status == shim.OK) == tt.ok || (revoke.Status == shim.OK) == tt.ok {
+				t.Fatalf("吊销后 updateEdu() = %s, revokeEdu() = %s", update.Message, revoke.Message)
+			}
+		})
+	}
+}
@@ -44,6 +44,18 @@ type Education struct {
 
 	Photo	string	`json:"Photo"`	// 照片
 
+	Revoked	bool	`json:"Revoked,omitempty"`	// 是否已撤销
+	RevokeReason	string	`json:"RevokeReason,omitempty"`	// 撤销原因
+	RevokedAt	string	`json:"RevokedAt,omitempty"`	// 撤销时间(交易时间, RFC 3339)
+	RevokedBy	string	`json:"RevokedBy,omitempty"`	// 撤销者: 提交撤销交易的账号或证书 CN
+
+	SaltNonce	string	`json:"SaltNonce,omitempty"`	// 派生各字段盐值的随机数, 盐值本身只经由 transient 传入
+	Commitments	map[string]string	`json:"Commitments,omitempty"`	// 各字段的加盐哈希承诺, 键为字段名
+	CommitRoot	string	`json:"CommitRoot,omitempty"`	// 全部承诺的摘要, 用于查询承诺
+
+	Signature	string	`json:"Signature,omitempty"`	// 学校对信息规范化序列化的签名(base64 编码的 DER)
+	SignerCert	string	`json:"SignerCert,omitempty"`	// 签名身份的证书(PEM), 与提交交易的身份一致
+
 	Historys	[]HistoryItem	// 当前edu的历史记录
 }
 
@@ -51,3 +63,22 @@ type HistoryItem struct {
 	TxId	string
 	Education	Education
 }
+
+// 根据承诺摘要查询到的承诺及信息状态, 不包含身份证号等信息本身
+type CommitmentRecord struct {
+	Root	string
+	Commitments	map[string]string
+	TxID	string	// 生成该组承诺的交易
+	Current	bool	// 是否为信息的当前版本
+	Revoked	bool
+	RevokedAt	string	`json:",omitempty"`
+}
+
+// 已在 fabric-ca 吊销的证书, 以 AKI 及序列号标识
+type RevokedCert struct {
+	AKI	string
+	Serial	string
+	Reason	string
+	RevokedAt	string	// 记录时间(交易时间, RFC 3339)
+	RevokedBy	string	// 记录吊销的身份的 CN
+}
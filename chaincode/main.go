@@ -33,6 +33,14 @@ func (t *EducationChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Respo
 		return t.updateEdu(stub, args)		// 根据证书编号更新信息
 	}else if fun == "delEdu"{
 		return t.delEdu(stub, args)	// 根据证书编号删除信息
+	}else if fun == "revokeEdu"{
+		return t.revokeEdu(stub, args)	// 根据身份证号撤销信息
+	}else if fun == "queryPhotos"{
+		return t.queryPhotos(stub, args)	// 查询引用的全部照片
+	}else if fun == "queryCommitments"{
+		return t.queryCommitments(stub, args)	// 根据承诺摘要查询各字段的承诺及信息状态
+	}else if fun == "revokeCert"{
+		return t.revokeCert(stub, args)	// 记录已吊销的证书
 	}
 
 	return shim.Error("指定的函数名称错误")
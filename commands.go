@@ -0,0 +1,365 @@
+/**
+  author: kevin
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"encoding/json"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/sdkInit"
+	"github.com/kongyixueyuan.com/education/service"
+	"github.com/kongyixueyuan.com/education/web"
+	"github.com/kongyixueyuan.com/education/web/controller"
+)
+
+// 创建通道、加入节点并安装、实例化链码, 已完成的步骤会被跳过
+func runBootstrap(env *appEnv, flags *pflag.FlagSet) error {
+	err := sdkInit.CreateChannel(env.sdk, env.info)
+	if err != nil {
+		return err
+	}
+
+	_, err = sdkInit.InstallAndInstantiateCC(env.sdk, env.info)
+	return err
+}
+
+func upgradeFlags(flags *pflag.FlagSet) {
+	flags.String("version", "", "链码的新版本, 为空时在当前版本基础上递增")
+	flags.String("collections", "", "私有数据集合配置文件(可选)")
+}
+
+// 升级链码至指定版本
+func runUpgrade(env *appEnv, flags *pflag.FlagSet) error {
+	version, _ := flags.GetString("version")
+	collections, _ := flags.GetString("collections")
+	return sdkInit.UpgradeCC(env.sdk, env.info, version, collections)
+}
+
+// 启动 Web 服务
+func runServe(env *appEnv, flags *pflag.FlagSet) error {
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	resMgmtClient, err := sdkInit.CreateResMgmtClient(env.sdk, env.info)
+	if err != nil {
+		return err
+	}
+
+	peers, err := sdkInit.OrgPeers(env.sdk, env.info)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(env.cfg.DataDir, 0700)
+	if err != nil {
+		return fmt.Errorf("创建数据目录失败: %v", err)
+	}
+
+	// 调用链码前先写入发件箱, 上次退出时未确认的调用在核对账本后重新提交
+	outbox, err := service.OpenOutbox(filepath.Join(env.cfg.DataDir, "outbox.log"))
+	if err != nil {
+		return err
+	}
+	serviceSetup.Outbox = outbox
+
+	// 添加及修改信息时为各字段生成加盐哈希承诺, 盐值由此密钥派生
+	serviceSetup.SaltKey, err = service.LoadSaltKey(filepath.Join(env.cfg.DataDir, "salt.key"))
+	if err != nil {
+		return err
+	}
+
+	identities, err := env.identitySetup(serviceSetup)
+	if err != nil {
+		return err
+	}
+	go outbox.Reconcile(identities.SetupFor)
+
+	users, err := service.OpenUserStore(filepath.Join(env.cfg.DataDir, "users.json"))
+	if err != nil {
+		return err
+	}
+	if users.Empty() {
+		fmt.Println("尚未创建任何账号, 请访问 Web 服务创建初始管理员")
+	}
+
+	apiKeys, err := service.OpenAPIKeyStore(filepath.Join(env.cfg.DataDir, "apikeys.json"))
+	if err != nil {
+		return err
+	}
+	go flushAPIKeys(apiKeys)
+
+	tokens, err := env.tokenIssuer()
+	if err != nil {
+		return err
+	}
+
+	jobs, err := service.OpenJobQueue(filepath.Join(env.cfg.DataDir, "jobs.json"), identities.SetupFor)
+	if err != nil {
+		return err
+	}
+	jobs.MaxAttempts = env.cfg.Jobs.MaxAttempts
+	jobs.RetryDelay = env.cfg.Jobs.RetryDelay
+	jobs.Start(env.cfg.Jobs.Workers)
+
+	attachments, err := env.attachments()
+	if err != nil {
+		return err
+	}
+	if env.cfg.Storage.GCInterval > 0 {
+		go collectGarbageEvery(env.cfg.Storage.GCInterval, serviceSetup, attachments, env.cfg.Storage.GCGrace)
+	}
+
+	verifications, err := service.OpenVerificationStore(filepath.Join(env.cfg.DataDir, "verifications.json"))
+	if err != nil {
+		return err
+	}
+	verifications.TTL = env.cfg.Verify.CodeTTL
+
+	verifyLog, err := service.OpenVerifyLog(filepath.Join(env.cfg.DataDir, "verify.log"))
+	if err != nil {
+		return err
+	}
+
+	credentials, err := env.credentials(identities)
+	if err != nil {
+		return err
+	}
+
+	photos := service.NewPhotoProcessor()
+	photos.MaxSize = env.cfg.Upload.MaxSize
+	photos.MaxWidth = env.cfg.Upload.MaxWidth
+	photos.MaxHeight = env.cfg.Upload.MaxHeight
+	photos.ThumbWidth = env.cfg.Upload.ThumbWidth
+	photos.ThumbHeight = env.cfg.Upload.ThumbHeight
+
+	app := controller.Application{
+		Setup: serviceSetup,
+		Identities: identities,
+		Users: users,
+		APIKeys: apiKeys,
+		Tokens: tokens,
+		Jobs: jobs,
+		Photos: photos,
+		Attachments: attachments,
+		Verifications: verifications,
+		BaseURL: strings.TrimRight(env.cfg.Verify.BaseURL, "/"),
+		VerifyLog: verifyLog,
+		VerifyLimiter: controller.NewRateLimiter(env.cfg.Verify.RateLimit, time.Minute),
+		TrustProxy: env.cfg.Verify.TrustProxy,
+		Credentials: credentials,
+		Network: &service.NetworkSetup{
+			ChannelID: env.info.ChannelID,
+			ChaincodeID: env.info.ChaincodeID,
+			OrgName: env.info.OrgName,
+			ConfiguredPolicy: env.info.Policy(),
+			Peers: peers,
+			ResMgmt: resMgmtClient,
+			Client: serviceSetup.Client,
+		},
+	}
+	web.WebStart(app, env.cfg.Web)
+	return nil
+}
+
+// 创建身份管理, 读取数据目录中 Web 账号与 Fabric 身份的对应关系
+func (env *appEnv) identitySetup(defaultSetup *service.ServiceSetup) (*service.IdentitySetup, error) {
+	mspClient, err := sdkInit.CreateMSPClient(env.sdk, env.info)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := &service.IdentitySetup{
+		SDK: env.sdk,
+		MSP: mspClient,
+		ChannelID: env.info.ChannelID,
+		OrgName: env.info.OrgName,
+		Affiliation: env.cfg.Org.Affiliation,
+		Default: defaultSetup,
+		StorePath: filepath.Join(env.cfg.DataDir, "identities.json"),
+	}
+	return identities, identities.Load()
+}
+
+// 定期保存 API 密钥的使用次数
+func flushAPIKeys(keys *service.APIKeyStore) {
+	for range time.Tick(time.Minute) {
+		if err := keys.Flush(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// 创建可验证凭证的签发者, 读取配置的可信证书
+func (env *appEnv) credentials(identities *service.IdentitySetup) (*service.Credentials, error) {
+	// 凭证由学校已注册 Fabric 身份的账号签名, 签发者为配置中该学校的 DID
+	credentials := &service.Credentials{
+		SignerFor: func(school string) (*service.Signer, error) {
+			setup, err := identities.SetupForSchool(school)
+			if err != nil {
+				return nil, err
+			}
+			return setup.Signer, nil
+		},
+		Issuers: make(map[string]string),
+	}
+	for _, issuer := range env.cfg.Credential.Issuers {
+		credentials.Issuers[issuer.School] = issuer.DID
+	}
+	if env.cfg.Credential.TrustedCerts == "" {
+		return credentials, nil
+	}
+
+	b, err := ioutil.ReadFile(env.cfg.Credential.TrustedCerts)
+	if err != nil {
+		return nil, fmt.Errorf("读取可信证书失败: %v", err)
+	}
+	credentials.Trusted, err = service.ParseCertificates(b)
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// 创建访问令牌的签发者, 未配置签名密钥时使用数据目录中的密钥
+func (env *appEnv) tokenIssuer() (*service.TokenIssuer, error) {
+	secret := []byte(env.cfg.API.TokenSecret)
+	if len(secret) == 0 {
+		var err error
+		secret, err = service.LoadTokenSecret(filepath.Join(env.cfg.DataDir, "token.key"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &service.TokenIssuer{Secret: secret, TTL: env.cfg.API.TokenTTL}, nil
+}
+
+func queryFlags(flags *pflag.FlagSet) {
+	flags.String("id", "", "身份证号")
+	flags.String("cert", "", "证书编号, 需同时指定 --name")
+	flags.String("name", "", "姓名")
+}
+
+// 根据身份证号或证书编号与姓名查询信息
+func runQuery(env *appEnv, flags *pflag.FlagSet) error {
+	entityID, _ := flags.GetString("id")
+	certNo, _ := flags.GetString("cert")
+	name, _ := flags.GetString("name")
+	if entityID == "" && (certNo == "" || name == "") {
+		return fmt.Errorf("请指定 --id 或同时指定 --cert 与 --name")
+	}
+
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	var result []byte
+	if entityID != "" {
+		result, err = serviceSetup.FindEduInfoByEntityID(entityID)
+	} else {
+		result, err = serviceSetup.FindEduByCertNoAndName(certNo, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	var edu service.Education
+	err = json.Unmarshal(result, &edu)
+	if err != nil {
+		return fmt.Errorf("反序列化edu信息失败: %v", err)
+	}
+	edu.Historys = nil
+
+	return printJSON(edu)
+}
+
+func historyFlags(flags *pflag.FlagSet) {
+	flags.String("id", "", "身份证号")
+}
+
+// 根据身份证号查询信息及其历史记录, 历史记录中包含交易所在的区块及时间
+func runHistory(env *appEnv, flags *pflag.FlagSet) error {
+	entityID, _ := flags.GetString("id")
+	if entityID == "" {
+		return fmt.Errorf("请指定 --id")
+	}
+
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	result, err := serviceSetup.FindEduInfoByEntityID(entityID)
+	if err != nil {
+		return err
+	}
+
+	var edu service.Education
+	err = json.Unmarshal(result, &edu)
+	if err != nil {
+		return fmt.Errorf("反序列化edu信息失败: %v", err)
+	}
+	serviceSetup.EnrichHistory(&edu)
+
+	return printJSON(edu)
+}
+
+// 创建调用链码及查询账本所需的客户端
+func (env *appEnv) serviceSetup() (*service.ServiceSetup, error) {
+	channelClient, err := sdkInit.CreateChannelClient(env.sdk, env.info)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerClient, err := sdkInit.CreateLedgerClient(env.sdk, env.info)
+	if err != nil {
+		return nil, err
+	}
+
+	endorsers, err := sdkInit.EndorsingPeers(env.sdk, env.info)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加及修改的信息由签名交易的同一身份签名, 链码核验签名证书与交易提交者一致
+	signer, err := service.NewSigner(env.sdk, env.info.UserName, env.info.OrgName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &service.ServiceSetup{
+		ChaincodeID:env.info.ChaincodeID,
+		Client:channelClient,
+		Ledger:ledgerClient,
+		Endorsers:endorsers,
+		Signer:signer,
+	}, nil
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// 输出交易所在的区块号、提交时间及背书节点
+func printTxInfo(setup *service.ServiceSetup, txID string) {
+	info, err := setup.FindTxInfo(txID)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("区块号: %d, 提交时间: %s, 验证结果: %s, 背书节点: %v\n", info.BlockNumber, info.Timestamp.Format("2006-01-02 15:04:05"), info.ValidationCode, info.Endorsers)
+}
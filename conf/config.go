@@ -0,0 +1,374 @@
+/**
+  author: kevin
+*/
+
+package conf
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go/build"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 环境变量前缀, 如 EDU_WEB_ADDR 对应配置项 web.addr
+const envPrefix = "EDU"
+
+// 应用配置, 依次从默认值、配置文件、环境变量及命令行参数加载, 后者覆盖前者
+type Config struct {
+	Home      string // 项目根目录, 相对路径均以此为基准
+	SDKConfig string // Fabric SDK 配置文件
+	DataDir   string // 应用数据目录, 保存身份记录等本地状态
+
+	Channel    ChannelConfig
+	Org        OrgConfig
+	Chaincode  ChaincodeConfig
+	Web        WebConfig
+	Upload     UploadConfig
+	Storage    StorageConfig
+	API        APIConfig
+	Verify     VerifyConfig
+	Credential CredentialConfig
+	Jobs       JobsConfig
+}
+
+type ChannelConfig struct {
+	ID             string
+	ConfigPath     string // channel.tx
+	OrdererOrgName string
+}
+
+type OrgConfig struct {
+	Name        string
+	Admin       string
+	User        string // 未登记 Fabric 身份的 Web 账号使用的默认用户
+	Affiliation string // 在 fabric-ca 中登记新身份时使用的部门
+}
+
+type ChaincodeConfig struct {
+	ID      string
+	GoPath  string
+	Path    string // 链码在 GoPath/src 下的路径
+	Version string
+	Policy  string // 背书策略表达式, 如 AND('Org1MSP.peer','Org2MSP.peer')
+}
+
+type WebConfig struct {
+	Addr      string // 监听地址
+	TplDir    string // 模板目录
+	StaticDir string // 静态文件目录
+
+	SessionTTL   time.Duration // 会话闲置超过此时长后失效
+	SecureCookie bool          // 会话 Cookie 仅通过 HTTPS 发送
+}
+
+type APIConfig struct {
+	TokenTTL    time.Duration // 访问令牌的有效期
+	TokenSecret string        // 访问令牌的签名密钥, 为空时使用数据目录中自动生成的密钥
+}
+
+// 照片上传的限制及证件照缩略图尺寸
+type UploadConfig struct {
+	MaxSize     int64 // 照片文件大小上限(字节)
+	MaxWidth    int   // 照片的最大宽度及高度(像素)
+	MaxHeight   int
+	ThumbWidth  int // 证件照缩略图的宽度及高度(像素)
+	ThumbHeight int
+}
+
+// 照片等附件的存储, 文件以内容的 SHA-256 摘要为键保存
+type StorageConfig struct {
+	Backend    string        // local 或 s3
+	Dir        string        // local: 存储目录, 为空时使用数据目录下的 photos
+	S3         S3Config      // s3: S3 兼容的对象存储
+	GCInterval time.Duration // 自动清理未引用文件的间隔, 为 0 时不自动清理
+	GCGrace    time.Duration // 上传后未超过此时长的文件不会被清理
+}
+
+type S3Config struct {
+	Endpoint  string // 如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	Prefix    string // 对象键的前缀
+	AccessKey string
+	SecretKey string
+	PathStyle bool // 以 endpoint/bucket/key 的形式访问, MinIO 等通常需要
+}
+
+// 在线验证码及公开的验证页面
+type VerifyConfig struct {
+	BaseURL    string        // 验证页面的公开访问地址, 如 https://edu.example.com, 为空时使用请求的地址
+	CodeTTL    time.Duration // 在线验证码的最长有效期, 持证人可选择更短的有效期
+	RateLimit  int           // 每个客户端地址每分钟最多查询的次数
+	TrustProxy bool          // 部署在反向代理之后时根据 X-Forwarded-For 确定客户端地址
+}
+
+// W3C 可验证凭证的签发及核验, 凭证由信息所属学校的身份签名
+type CredentialConfig struct {
+	Issuers      []IssuerConfig // 各学校的 DID, 未配置的学校使用由签名证书指纹派生的标识
+	TrustedCerts string         // 核验凭证时信任的学校证书或 CA 证书(PEM), 为空时只信任各学校当前的签名证书
+}
+
+type IssuerConfig struct {
+	School string // 学校名称, 与学历信息中的学校名称一致
+	DID    string // 如 did:web:edu.example.com
+}
+
+// 添加及修改信息的提交任务队列
+type JobsConfig struct {
+	Workers     int           // 同时提交交易的 worker 数量
+	MaxAttempts int           // 读写冲突、排序服务不可用等暂时性错误的最大尝试次数
+	RetryDelay  time.Duration // 首次重试前的等待时间, 此后每次加倍
+}
+
+// 配置项默认值
+func setDefaults(v *viper.Viper) {
+	home, _ := os.Getwd()
+	v.SetDefault("home", home)
+	v.SetDefault("sdkConfig", "config.yaml")
+	v.SetDefault("dataDir", "data")
+
+	v.SetDefault("channel.id", "kevinkongyixueyuan")
+	v.SetDefault("channel.configPath", "fixtures/artifacts/channel.tx")
+	v.SetDefault("channel.ordererOrgName", "orderer.kevin.kongyixueyuan.com")
+
+	v.SetDefault("org.name", "Org1")
+	v.SetDefault("org.admin", "Admin")
+	v.SetDefault("org.user", "User1")
+	v.SetDefault("org.affiliation", "org1")
+
+	v.SetDefault("chaincode.id", "educc")
+	v.SetDefault("chaincode.goPath", filepath.SplitList(build.Default.GOPATH)[0])
+	v.SetDefault("chaincode.path", "github.com/kongyixueyuan.com/education/chaincode/")
+	v.SetDefault("chaincode.version", "")
+	v.SetDefault("chaincode.policy", "OR('org1.kevin.kongyixueyuan.com.member')")
+
+	v.SetDefault("web.addr", ":9000")
+	v.SetDefault("web.tplDir", "web/tpl")
+	v.SetDefault("web.staticDir", "web/static")
+	v.SetDefault("web.sessionTTL", "30m")
+	v.SetDefault("web.secureCookie", true)
+
+	v.SetDefault("upload.maxSize", 5<<20)
+	v.SetDefault("upload.maxWidth", 4096)
+	v.SetDefault("upload.maxHeight", 4096)
+	v.SetDefault("upload.thumbWidth", 120)
+	v.SetDefault("upload.thumbHeight", 160)
+
+	v.SetDefault("storage.backend", "local")
+	v.SetDefault("storage.dir", "")
+	v.SetDefault("storage.s3.endpoint", "")
+	v.SetDefault("storage.s3.region", "us-east-1")
+	v.SetDefault("storage.s3.bucket", "")
+	v.SetDefault("storage.s3.prefix", "photos/")
+	v.SetDefault("storage.s3.accessKey", "")
+	v.SetDefault("storage.s3.secretKey", "")
+	v.SetDefault("storage.s3.pathStyle", true)
+	v.SetDefault("storage.gcInterval", "24h")
+	v.SetDefault("storage.gcGrace", "24h")
+
+	v.SetDefault("api.tokenTTL", "15m")
+	v.SetDefault("api.tokenSecret", "")
+
+	v.SetDefault("verify.baseURL", "")
+	v.SetDefault("verify.codeTTL", "720h")
+	v.SetDefault("verify.rateLimit", 20)
+	v.SetDefault("verify.trustProxy", false)
+
+	v.SetDefault("credential.issuers", []IssuerConfig{})
+	v.SetDefault("credential.trustedCerts", "")
+
+	v.SetDefault("jobs.workers", 4)
+	v.SetDefault("jobs.maxAttempts", 5)
+	v.SetDefault("jobs.retryDelay", "2s")
+}
+
+// 注册可覆盖配置项的命令行参数
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String("config", "app.yaml", "应用配置文件")
+	flags.String("home", "", "项目根目录")
+	flags.String("sdk-config", "", "Fabric SDK 配置文件")
+	flags.String("data-dir", "", "应用数据目录")
+	flags.String("channel-id", "", "应用通道名称")
+	flags.String("org", "", "组织名称")
+	flags.String("user", "", "调用链码使用的用户")
+	flags.String("cc-version", "", "链码版本")
+	flags.String("cc-policy", "", "链码背书策略表达式")
+	flags.String("listen", "", "Web 服务监听地址")
+}
+
+// 命令行参数与配置项的对应关系
+var flagKeys = map[string]string{
+	"home":       "home",
+	"sdk-config": "sdkConfig",
+	"data-dir":   "dataDir",
+	"channel-id": "channel.id",
+	"org":        "org.name",
+	"user":       "org.user",
+	"cc-version": "chaincode.version",
+	"cc-policy":  "chaincode.policy",
+	"listen":     "web.addr",
+}
+
+// 加载并校验执行指定子命令所需的配置
+func Load(flags *pflag.FlagSet, command string) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	// 仅在命令行中显式指定的参数才会覆盖配置
+	for name, key := range flagKeys {
+		if f := flags.Lookup(name); f != nil {
+			v.BindPFlag(key, f)
+		}
+	}
+
+	// 未显式指定配置文件且默认配置文件不存在时仅使用默认值
+	configFile, _ := flags.GetString("config")
+	if _, err := os.Stat(configFile); err == nil || flags.Changed("config") {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("读取配置文件 %s 失败: %v", configFile, err)
+		}
+	}
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %v", err)
+	}
+
+	cfg.resolvePaths()
+	if err := cfg.Validate(command); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// 将相对路径转换为基于项目根目录的路径
+func (c *Config) resolvePaths() {
+	c.Home, _ = filepath.Abs(c.Home)
+	if c.Storage.Dir == "" && c.DataDir != "" {
+		c.Storage.Dir = filepath.Join(c.DataDir, "photos")
+	}
+	for _, p := range []*string{&c.SDKConfig, &c.DataDir, &c.Channel.ConfigPath, &c.Web.TplDir, &c.Web.StaticDir, &c.Storage.Dir, &c.Credential.TrustedCerts} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(c.Home, *p)
+		}
+	}
+}
+
+// 校验配置项, 子命令所需的文件必须存在
+func (c *Config) Validate(command string) error {
+	required := map[string]string{
+		"channel.id":             c.Channel.ID,
+		"channel.ordererOrgName": c.Channel.OrdererOrgName,
+		"org.name":               c.Org.Name,
+		"org.admin":              c.Org.Admin,
+		"org.user":               c.Org.User,
+		"org.affiliation":        c.Org.Affiliation,
+		"dataDir":                c.DataDir,
+		"chaincode.id":           c.Chaincode.ID,
+		"chaincode.goPath":       c.Chaincode.GoPath,
+		"chaincode.path":         c.Chaincode.Path,
+		"chaincode.policy":       c.Chaincode.Policy,
+		"web.addr":               c.Web.Addr,
+	}
+	for key, value := range required {
+		if value == "" {
+			return fmt.Errorf("配置项 %s 不能为空", key)
+		}
+	}
+
+	if c.Web.SessionTTL <= 0 {
+		return fmt.Errorf("配置项 web.sessionTTL 必须大于 0")
+	}
+	if c.API.TokenTTL <= 0 {
+		return fmt.Errorf("配置项 api.tokenTTL 必须大于 0")
+	}
+
+	if c.Upload.MaxSize <= 0 || c.Upload.MaxWidth <= 0 || c.Upload.MaxHeight <= 0 || c.Upload.ThumbWidth <= 0 || c.Upload.ThumbHeight <= 0 {
+		return fmt.Errorf("配置项 upload 中的大小及尺寸必须大于 0")
+	}
+	if c.Upload.ThumbWidth > c.Upload.MaxWidth || c.Upload.ThumbHeight > c.Upload.MaxHeight {
+		return fmt.Errorf("配置项 upload.thumbWidth 及 upload.thumbHeight 不能超过照片的最大尺寸")
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Region == "" || c.Storage.S3.Bucket == "" {
+			return fmt.Errorf("使用 s3 存储时配置项 storage.s3.endpoint、storage.s3.region 及 storage.s3.bucket 不能为空")
+		}
+	default:
+		return fmt.Errorf("配置项 storage.backend 只能为 local 或 s3")
+	}
+	if c.Storage.GCInterval < 0 || c.Storage.GCGrace <= 0 {
+		return fmt.Errorf("配置项 storage.gcInterval 不能小于 0, storage.gcGrace 必须大于 0")
+	}
+
+	if c.Verify.CodeTTL <= 0 {
+		return fmt.Errorf("配置项 verify.codeTTL 必须大于 0")
+	}
+	if c.Verify.RateLimit <= 0 {
+		return fmt.Errorf("配置项 verify.rateLimit 必须大于 0")
+	}
+	if c.Verify.BaseURL != "" {
+		if u, err := url.Parse(c.Verify.BaseURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("配置项 verify.baseURL 须为 http 或 https 地址")
+		}
+	}
+
+	schools := make(map[string]bool)
+	for _, issuer := range c.Credential.Issuers {
+		if issuer.School == "" || !strings.HasPrefix(issuer.DID, "did:") {
+			return fmt.Errorf("配置项 credential.issuers 须为学校名称(school)及其 DID(did, 如 did:web:edu.example.com)")
+		}
+		if schools[issuer.School] {
+			return fmt.Errorf("配置项 credential.issuers 中学校 %s 重复", issuer.School)
+		}
+		schools[issuer.School] = true
+	}
+
+	if c.Jobs.Workers <= 0 || c.Jobs.MaxAttempts <= 0 || c.Jobs.RetryDelay <= 0 {
+		return fmt.Errorf("配置项 jobs.workers、jobs.maxAttempts 及 jobs.retryDelay 必须大于 0")
+	}
+
+	if _, err := cauthdsl.FromString(c.Chaincode.Policy); err != nil {
+		return fmt.Errorf("配置项 chaincode.policy 不是有效的背书策略: %v", err)
+	}
+
+	files := map[string]string{
+		"sdkConfig": c.SDKConfig,
+	}
+	// 通道配置及链码源码只在创建通道、安装链码时使用, 页面模板及静态文件只在 Web 服务中使用
+	switch command {
+	case "bootstrap":
+		files["channel.configPath"] = c.Channel.ConfigPath
+		files["chaincode.path"] = filepath.Join(c.Chaincode.GoPath, "src", c.Chaincode.Path)
+	case "upgrade":
+		files["chaincode.path"] = filepath.Join(c.Chaincode.GoPath, "src", c.Chaincode.Path)
+	case "serve":
+		files["web.tplDir"] = c.Web.TplDir
+		files["web.staticDir"] = c.Web.StaticDir
+	}
+	if c.Credential.TrustedCerts != "" {
+		files["credential.trustedCerts"] = c.Credential.TrustedCerts
+	}
+	for key, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("配置项 %s 指定的路径不可用: %v", key, err)
+		}
+	}
+
+	return nil
+}
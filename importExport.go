@@ -0,0 +1,212 @@
+/**
+  author: kevin
+ */
+
+package main
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"bufio"
+	"strings"
+	"path/filepath"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+func importFlags(flags *pflag.FlagSet) {
+	flags.String("file", "", "要导入的文件")
+	flags.String("format", "", "文件格式 csv 或 json, 为空时根据扩展名判断")
+}
+
+// 从 CSV 或 JSON 文件批量导入信息, 单条失败不影响其他记录
+func runImport(env *appEnv, flags *pflag.FlagSet) error {
+	file, _ := flags.GetString("file")
+	if file == "" {
+		return fmt.Errorf("请指定 --file")
+	}
+	format, _ := flags.GetString("format")
+
+	edus, err := readEdus(file, fileFormat(file, format))
+	if err != nil {
+		return err
+	}
+
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	// 信息须由所属学校的身份签名
+	identities, err := env.identitySetup(serviceSetup)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, edu := range edus {
+		setup, err := identities.SetupForSchool(edu.SchoolName)
+		var msg string
+		if err == nil {
+			msg, err = setup.SaveEdu(edu)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("导入 %s 失败: %v\n", edu.EntityID, err)
+			continue
+		}
+		fmt.Printf("导入 %s 成功, 交易编号为: %s\n", edu.EntityID, msg)
+	}
+
+	fmt.Printf("共 %d 条, 成功 %d 条, 失败 %d 条\n", len(edus), len(edus)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("部分信息导入失败")
+	}
+	return nil
+}
+
+func exportFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("id", nil, "要导出的身份证号, 可多次指定或以逗号分隔")
+	flags.String("ids-file", "", "包含身份证号的文件, 每行一个")
+	flags.String("out", "", "输出文件, 为空时输出到标准输出")
+	flags.String("format", "", "文件格式 csv 或 json, 为空时根据扩展名判断, 默认 json")
+}
+
+// 将指定身份证号的信息导出为 CSV 或 JSON
+func runExport(env *appEnv, flags *pflag.FlagSet) error {
+	ids, _ := flags.GetStringSlice("id")
+	idsFile, _ := flags.GetString("ids-file")
+	out, _ := flags.GetString("out")
+	format, _ := flags.GetString("format")
+
+	if idsFile != "" {
+		more, err := readLines(idsFile)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, more...)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("请通过 --id 或 --ids-file 指定要导出的身份证号")
+	}
+
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	var edus []service.Education
+	for _, id := range ids {
+		result, err := serviceSetup.FindEduInfoByEntityID(id)
+		if err != nil {
+			return fmt.Errorf("查询 %s 失败: %v", id, err)
+		}
+
+		var edu service.Education
+		err = json.Unmarshal(result, &edu)
+		if err != nil {
+			return fmt.Errorf("反序列化 %s 的信息失败: %v", id, err)
+		}
+		edu.Historys = nil
+		edus = append(edus, edu)
+	}
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("创建输出文件失败: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return writeEdus(w, edus, fileFormat(out, format))
+}
+
+// 未指定格式时根据文件扩展名判断, 默认 json
+func fileFormat(file, format string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if strings.ToLower(filepath.Ext(file)) == ".csv" {
+		return "csv"
+	}
+	return "json"
+}
+
+func readEdus(file, format string) ([]service.Education, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var edus []service.Education
+	switch format {
+	case "json":
+		err = json.NewDecoder(f).Decode(&edus)
+		if err != nil {
+			return nil, fmt.Errorf("解析 JSON 文件失败: %v", err)
+		}
+	case "csv":
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("解析 CSV 文件失败: %v", err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("CSV 文件缺少表头")
+		}
+		for i, record := range records[1:] {
+			edu, err := service.EduFromCSVRecord(records[0], record)
+			if err != nil {
+				return nil, fmt.Errorf("CSV 文件第 %d 行: %v", i+2, err)
+			}
+			edus = append(edus, edu)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的文件格式: %s", format)
+	}
+
+	return edus, nil
+}
+
+func writeEdus(w io.Writer, edus []service.Education, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(edus)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(service.EduCSVHeader)
+		for _, edu := range edus {
+			cw.Write(edu.CSVRecord())
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("不支持的文件格式: %s", format)
+	}
+}
+
+// 读取文件中的非空行
+func readLines(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -7,214 +7,130 @@ package main
 import (
 	"os"
 	"fmt"
+	"strings"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/conf"
 	"github.com/kongyixueyuan.com/education/sdkInit"
-	"github.com/kongyixueyuan.com/education/service"
-	"encoding/json"
-	"github.com/kongyixueyuan.com/education/web/controller"
-	"github.com/kongyixueyuan.com/education/web"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 )
 
-const (
-	configFile = "config.yaml"
-	initialized = false
-	EduCC = "educc"
-)
-
-func main() {
+// Fabric SDK 配置文件中以 ${EDUCATION_HOME} 引用项目根目录
+const homeEnv = "EDUCATION_HOME"
 
-	initInfo := &sdkInit.InitInfo{
+// 子命令
+type command struct {
+	Name	string
+	Desc	string
+	Flags	func(flags *pflag.FlagSet)	// 子命令特有的参数
+	Run	func(env *appEnv, flags *pflag.FlagSet) error
+	Offline	bool	// 不需要连接网络, 不初始化 SDK
+}
 
-		ChannelID: "kevinkongyixueyuan",
-		ChannelConfig: os.Getenv("GOPATH") + "/src/github.com/kongyixueyuan.com/education/fixtures/artifacts/channel.tx",
+// 按帮助信息中的显示顺序排列
+var commands = []*command{
+	{Name: "bootstrap", Desc: "创建通道、加入节点并安装、实例化链码", Run: runBootstrap},
+	{Name: "upgrade", Desc: "升级链码", Flags: upgradeFlags, Run: runUpgrade},
+	{Name: "serve", Desc: "启动 Web 服务", Run: runServe},
+	{Name: "seed", Desc: "写入演示数据", Run: runSeed},
+	{Name: "query", Desc: "根据身份证号或证书编号与姓名查询信息, 以 JSON 格式输出", Flags: queryFlags, Run: runQuery},
+	{Name: "history", Desc: "根据身份证号查询信息及其历史记录, 以 JSON 格式输出", Flags: historyFlags, Run: runHistory},
+	{Name: "import", Desc: "从 CSV 或 JSON 文件批量导入信息", Flags: importFlags, Run: runImport},
+	{Name: "export", Desc: "将指定身份证号的信息导出为 CSV 或 JSON", Flags: exportFlags, Run: runExport},
+	{Name: "gc", Desc: "列出账本中未引用的照片文件, 由 Web 服务定期清理", Run: runGC},
+	{Name: "verify", Desc: "离线核验导出信息中的学校签名", Flags: verifyFlags, Run: runVerify, Offline: true},
+}
 
-		OrgAdmin:"Admin",
-		OrgName:"Org1",
-		OrdererOrgName: "orderer.kevin.kongyixueyuan.com",
+// 子命令的运行环境
+type appEnv struct {
+	cfg	*conf.Config
+	info	*sdkInit.InitInfo
+	sdk	*fabsdk.FabricSDK
+}
 
-		ChaincodeID: EduCC,
-		ChaincodeGoPath: os.Getenv("GOPATH"),
-		ChaincodePath: "github.com/kongyixueyuan.com/education/chaincode/",
-		UserName:"User1",
+func main() {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		usage()
+		os.Exit(2)
 	}
 
-	sdk, err := sdkInit.SetupSDK(configFile, initialized)
-	if err != nil {
-		fmt.Printf(err.Error())
-		return
+	cmd := findCommand(os.Args[1])
+	if cmd == nil {
+		fmt.Printf("未知的子命令: %s\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
 	}
 
-	defer sdk.Close()
+	flags := pflag.NewFlagSet("education "+cmd.Name, pflag.ExitOnError)
+	conf.AddFlags(flags)
+	if cmd.Flags != nil {
+		cmd.Flags(flags)
+	}
+	flags.Parse(os.Args[2:])
 
-	err = sdkInit.CreateChannel(sdk, initInfo)
-	if err != nil {
+	if err := run(cmd, flags); err != nil {
 		fmt.Println(err.Error())
-		return
+		os.Exit(1)
 	}
+}
 
-	channelClient, err := sdkInit.InstallAndInstantiateCC(sdk, initInfo)
+// 加载配置、初始化SDK并执行子命令
+func run(cmd *command, flags *pflag.FlagSet) error {
+	cfg, err := conf.Load(flags, cmd.Name)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return err
 	}
-	fmt.Println(channelClient)
-
-	//===========================================//
 
-	serviceSetup := service.ServiceSetup{
-		ChaincodeID:EduCC,
-		Client:channelClient,
+	if os.Getenv(homeEnv) == "" {
+		os.Setenv(homeEnv, cfg.Home)
 	}
 
-	edu := service.Education{
-		Name: "张三",
-		Gender: "男",
-		Nation: "汉",
-		EntityID: "101",
-		Place: "北京",
-		BirthDay: "1991年01月01日",
-		EnrollDate: "2009年9月",
-		GraduationDate: "2013年7月",
-		SchoolName: "中国政法大学",
-		Major: "社会学",
-		QuaType: "普通",
-		Length: "四年",
-		Mode: "普通全日制",
-		Level: "本科",
-		Graduation: "毕业",
-		CertNo: "111",
-		Photo: "/static/photo/11.png",
-	}
+	initInfo := &sdkInit.InitInfo{
 
-	edu2 := service.Education{
-		Name: "李四",
-		Gender: "男",
-		Nation: "汉",
-		EntityID: "102",
-		Place: "上海",
-		BirthDay: "1992年02月01日",
-		EnrollDate: "2010年9月",
-		GraduationDate: "2014年7月",
-		SchoolName: "中国人民大学",
-		Major: "行政管理",
-		QuaType: "普通",
-		Length: "四年",
-		Mode: "普通全日制",
-		Level: "本科",
-		Graduation: "毕业",
-		CertNo: "222",
-		Photo: "/static/photo/22.png",
-	}
+		ChannelID: cfg.Channel.ID,
+		ChannelConfig: cfg.Channel.ConfigPath,
 
-	msg, err := serviceSetup.SaveEdu(edu)
-	if err != nil {
-		fmt.Println(err.Error())
-	}else {
-		fmt.Println("信息发布成功, 交易编号为: " + msg)
-	}
+		OrgAdmin:cfg.Org.Admin,
+		OrgName:cfg.Org.Name,
+		OrdererOrgName: cfg.Channel.OrdererOrgName,
 
-	msg, err = serviceSetup.SaveEdu(edu2)
-	if err != nil {
-		fmt.Println(err.Error())
-	}else {
-		fmt.Println("信息发布成功, 交易编号为: " + msg)
+		ChaincodeID: cfg.Chaincode.ID,
+		ChaincodeGoPath: cfg.Chaincode.GoPath,
+		ChaincodePath: cfg.Chaincode.Path,
+		ChaincodeVersion: cfg.Chaincode.Version,
+		ChaincodePolicy: cfg.Chaincode.Policy,
+		UserName:cfg.Org.User,
 	}
 
-	// 根据证书编号与名称查询信息
-	result, err := serviceSetup.FindEduByCertNoAndName("222","李四")
-	if err != nil {
-		fmt.Println(err.Error())
-	} else {
-		var edu service.Education
-		json.Unmarshal(result, &edu)
-		fmt.Println("根据证书编号与姓名查询信息成功：")
-		fmt.Println(edu)
+	if cmd.Offline {
+		return cmd.Run(&appEnv{cfg: cfg, info: initInfo}, flags)
 	}
 
-	// 根据身份证号码查询信息
-	result, err = serviceSetup.FindEduInfoByEntityID("101")
+	sdk, err := sdkInit.SetupSDK(cfg.SDKConfig)
 	if err != nil {
-		fmt.Println(err.Error())
-	} else {
-		var edu service.Education
-		json.Unmarshal(result, &edu)
-		fmt.Println("根据身份证号码查询信息成功：")
-		fmt.Println(edu)
+		return err
 	}
 
-	// 修改/添加信息
-	info := service.Education{
-		Name: "张三",
-		Gender: "男",
-		Nation: "汉",
-		EntityID: "101",
-		Place: "北京",
-		BirthDay: "1991年01月01日",
-		EnrollDate: "2013年9月",
-		GraduationDate: "2015年7月",
-		SchoolName: "中国政法大学",
-		Major: "社会学",
-		QuaType: "普通",
-		Length: "两年",
-		Mode: "普通全日制",
-		Level: "研究生",
-		Graduation: "毕业",
-		CertNo: "333",
-		Photo: "/static/photo/11.png",
-	}
-	msg, err = serviceSetup.ModifyEdu(info)
-	if err != nil {
-		fmt.Println(err.Error())
-	}else {
-		fmt.Println("信息操作成功, 交易编号为: " + msg)
-	}
-
-	// 根据身份证号码查询信息
-	result, err = serviceSetup.FindEduInfoByEntityID("101")
-	if err != nil {
-		fmt.Println(err.Error())
-	} else {
-		var edu service.Education
-		json.Unmarshal(result, &edu)
-		fmt.Println("根据身份证号码查询信息成功：")
-		fmt.Println(edu)
-	}
+	defer sdk.Close()
 
-	// 根据证书编号与名称查询信息
-	result, err = serviceSetup.FindEduByCertNoAndName("333","张三")
-	if err != nil {
-		fmt.Println(err.Error())
-	} else {
-		var edu service.Education
-		json.Unmarshal(result, &edu)
-		fmt.Println("根据证书编号与姓名查询信息成功：")
-		fmt.Println(edu)
-	}
+	return cmd.Run(&appEnv{cfg: cfg, info: initInfo, sdk: sdk}, flags)
+}
 
-	/*// 删除信息
-	msg, err = serviceSetup.DelEdu("101")
-	if err != nil {
-		fmt.Println(err.Error())
-	}else {
-		fmt.Println("信息删除成功, 交易编号为: " + msg)
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
 	}
+	return nil
+}
 
-	// 根据身份证号码查询信息
-	result, err = serviceSetup.FindEduInfoByEntityID("101")
-	if err != nil {
-		fmt.Println(err.Error())
-		fmt.Println("根据身份证号码查询信息失败，指定身份证号码的信息不存在或已被删除...")
-	} else {
-		var edu service.Education
-		json.Unmarshal(result, &edu)
-		fmt.Println("根据身份证号码查询信息成功：")
-		fmt.Println(edu)
-	}*/
-
-	//===========================================//
-
-	app := controller.Application{
-		Setup: &serviceSetup,
+func usage() {
+	fmt.Println("用法: education <子命令> [参数]")
+	fmt.Println()
+	fmt.Println("子命令:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.Name, cmd.Desc)
 	}
-	web.WebStart(app)
-
+	fmt.Println()
+	fmt.Println("执行 education <子命令> --help 查看子命令的参数")
 }
@@ -19,5 +19,23 @@ type InitInfo struct {
 	ChaincodeID	string
 	ChaincodeGoPath	string
 	ChaincodePath	string
+	ChaincodeVersion	string
+	ChaincodePolicy	string	// 背书策略表达式
 	UserName	string
 }
+
+// 背书策略表达式, 未指定时使用默认策略
+func (info *InitInfo) Policy() string {
+	if info.ChaincodePolicy == "" {
+		return DefaultPolicy
+	}
+	return info.ChaincodePolicy
+}
+
+// 链码版本, 未指定时使用默认版本
+func (info *InitInfo) Version() string {
+	if info.ChaincodeVersion == "" {
+		return ChaincodeVersion
+	}
+	return info.ChaincodeVersion
+}
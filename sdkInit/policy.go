@@ -0,0 +1,133 @@
+/**
+  author: kevin
+ */
+
+package sdkInit
+
+import (
+	"fmt"
+	"strings"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mspproto "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+)
+
+// 未配置背书策略时使用的默认策略: 本组织任一成员签名即可
+const DefaultPolicy = "OR('org1.kevin.kongyixueyuan.com.member')"
+
+// 解析背书策略表达式, 如 AND('Org1MSP.peer','Org2MSP.peer')
+func ParsePolicy(expr string) (*common.SignaturePolicyEnvelope, error) {
+	policy, err := cauthdsl.FromString(expr)
+	if err != nil {
+		return nil, fmt.Errorf("解析背书策略 %s 失败: %v", expr, err)
+	}
+	return policy, nil
+}
+
+// 背书策略中引用的 MSP ID
+func PolicyMSPs(policy *common.SignaturePolicyEnvelope) ([]string, error) {
+	var mspIDs []string
+	seen := make(map[string]bool)
+	for _, principal := range policy.Identities {
+		if principal.PrincipalClassification != mspproto.MSPPrincipal_ROLE {
+			return nil, fmt.Errorf("背书策略中仅支持基于角色的主体")
+		}
+
+		role := &mspproto.MSPRole{}
+		err := proto.Unmarshal(principal.Principal, role)
+		if err != nil {
+			return nil, fmt.Errorf("解析背书策略中的主体失败: %v", err)
+		}
+		if !seen[role.MspIdentifier] {
+			seen[role.MspIdentifier] = true
+			mspIDs = append(mspIDs, role.MspIdentifier)
+		}
+	}
+	return mspIDs, nil
+}
+
+// 链码的背书策略, 策略中引用的组织必须属于应用通道
+func chaincodePolicy(info *InitInfo) (*common.SignaturePolicyEnvelope, error) {
+	policy, err := ParsePolicy(info.Policy())
+	if err != nil {
+		return nil, err
+	}
+
+	mspIDs, err := PolicyMSPs(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	channelMSPs, err := channelMSPs(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range mspIDs {
+		if !channelMSPs[id] {
+			return nil, fmt.Errorf("背书策略中的组织 %s 不属于通道 %s", id, info.ChannelID)
+		}
+	}
+
+	return policy, nil
+}
+
+// 从排序节点获取通道配置, 返回通道中所有组织的 MSP ID
+func channelMSPs(info *InitInfo) (map[string]bool, error) {
+	cfg, err := info.OrgResMgmt.QueryConfigFromOrderer(info.ChannelID, resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
+	if err != nil {
+		return nil, fmt.Errorf("查询通道配置失败: %v", err)
+	}
+
+	mspIDs := make(map[string]bool)
+	for _, mspConfig := range cfg.MSPs() {
+		fabricConfig := &mspproto.FabricMSPConfig{}
+		err := proto.Unmarshal(mspConfig.Config, fabricConfig)
+		if err != nil {
+			return nil, fmt.Errorf("解析通道中的 MSP 配置失败: %v", err)
+		}
+		mspIDs[fabricConfig.Name] = true
+	}
+	return mspIDs, nil
+}
+
+// 背书策略所涉及组织的全部 Peer, 调用链码时向这些 Peer 发送背书请求
+func EndorsingPeers(sdk *fabsdk.FabricSDK, info *InitInfo) ([]string, error) {
+	policy, err := ParsePolicy(info.Policy())
+	if err != nil {
+		return nil, err
+	}
+
+	mspIDs, err := PolicyMSPs(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := sdk.Context(fabsdk.WithUser(info.OrgAdmin), fabsdk.WithOrg(info.OrgName))()
+	if err != nil {
+		return nil, fmt.Errorf("创建客户端Context失败: %v", err)
+	}
+	orgs := ctx.EndpointConfig().NetworkConfig().Organizations
+
+	var peers []string
+	for _, id := range mspIDs {
+		found := false
+		for _, org := range orgs {
+			if org.MSPID == id {
+				peers = append(peers, org.Peers...)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("SDK 配置文件中没有找到 MSP ID 为 %s 的组织", id)
+		}
+	}
+
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("背书策略 %s 所涉及的组织没有配置 Peer 节点", strings.Join(mspIDs, ","))
+	}
+	return peers, nil
+}
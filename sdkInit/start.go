@@ -5,6 +5,7 @@
 package sdkInit
 
 import (
+	"strings"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
 	"fmt"
@@ -12,18 +13,23 @@ import (
 	mspclient "github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
     
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/ccpackager/gopackager"
-	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 
 )
 
 
+// 未指定链码版本时使用的默认版本
 const ChaincodeVersion  = "1.0"
 
+// SDK 是否已被实例化, 防止重复初始化
+var initialized = false
 
-func SetupSDK(ConfigFile string, initialized bool) (*fabsdk.FabricSDK, error) {
+func SetupSDK(ConfigFile string) (*fabsdk.FabricSDK, error) {
 
 	if initialized {
 		return nil, fmt.Errorf("Fabric SDK已被实例化")
@@ -34,50 +40,76 @@ func SetupSDK(ConfigFile string, initialized bool) (*fabsdk.FabricSDK, error) {
 		return nil, fmt.Errorf("实例化Fabric SDK失败: %v", err)
 	}
 
+	initialized = true
 	fmt.Println("Fabric SDK初始化成功")
 	return sdk, nil
 }
 
 // 创建通道并将指定的Peers加入
+// 通道已存在时跳过创建, 已加入通道的 Peer 不再重复加入
 func CreateChannel(sdk *fabsdk.FabricSDK, info *InitInfo) error {
 
-	clientContext := sdk.Context(fabsdk.WithUser(info.OrgAdmin), fabsdk.WithOrg(info.OrgName))
-	if clientContext == nil {
-		return fmt.Errorf("根据指定的组织名称与管理员创建资源管理客户端Context失败")
-	}
-
-	// New returns a resource management client instance.
-	resMgmtClient, err := resmgmt.New(clientContext)
+	resMgmtClient, err := CreateResMgmtClient(sdk, info)
 	if err != nil {
-		return fmt.Errorf("根据指定的资源管理客户端Context创建通道管理客户端失败: %v", err)
+		return err
 	}
 
-	// New creates a new Client instance
-	mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(info.OrgName))
+	exists, err := channelExists(info)
 	if err != nil {
-		return fmt.Errorf("根据指定的 OrgName 创建 Org MSP 客户端实例失败: %v", err)
+		return err
 	}
+	if exists {
+		fmt.Println("通道已存在, 跳过创建通道")
+	} else {
+		// New creates a new Client instance
+		mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(info.OrgName))
+		if err != nil {
+			return fmt.Errorf("根据指定的 OrgName 创建 Org MSP 客户端实例失败: %v", err)
+		}
 
-	//  Returns: signing identity
-	adminIdentity, err := mspClient.GetSigningIdentity(info.OrgAdmin)
-	if err != nil {
-		return fmt.Errorf("获取指定id的签名标识失败: %v", err)
+		//  Returns: signing identity
+		adminIdentity, err := mspClient.GetSigningIdentity(info.OrgAdmin)
+		if err != nil {
+			return fmt.Errorf("获取指定id的签名标识失败: %v", err)
+		}
+
+		// SaveChannelRequest holds parameters for save channel request
+		channelReq := resmgmt.SaveChannelRequest{ChannelID:info.ChannelID, ChannelConfigPath:info.ChannelConfig, SigningIdentities:[]msp.SigningIdentity{adminIdentity}}
+		// save channel response with transaction ID
+		 _, err = resMgmtClient.SaveChannel(channelReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
+		if err != nil {
+			return fmt.Errorf("创建应用通道失败: %v", err)
+		}
+
+		fmt.Println("通道已成功创建，")
 	}
 
-	// SaveChannelRequest holds parameters for save channel request
-	channelReq := resmgmt.SaveChannelRequest{ChannelID:info.ChannelID, ChannelConfigPath:info.ChannelConfig, SigningIdentities:[]msp.SigningIdentity{adminIdentity}}
-	// save channel response with transaction ID
-	 _, err = resMgmtClient.SaveChannel(channelReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
+	peers, err := OrgPeers(sdk, info)
 	if err != nil {
-		return fmt.Errorf("创建应用通道失败: %v", err)
+		return err
 	}
 
-	fmt.Println("通道已成功创建，")
+	// 只将尚未加入通道的 Peer 加入通道
+	var unjoined []string
+	for _, peer := range peers {
+		joined, err := peerJoined(info, peer)
+		if err != nil {
+			return fmt.Errorf("查询 %s 已加入的通道失败: %v", peer, err)
+		}
+		if joined {
+			fmt.Printf("%s 已加入通道, 跳过\n", peer)
+			continue
+		}
+		unjoined = append(unjoined, peer)
+	}
 
-	info.OrgResMgmt = resMgmtClient
+	if len(unjoined) == 0 {
+		fmt.Println("peers 均已加入通道.")
+		return nil
+	}
 
 	// allows for peers to join existing channel with optional custom options (specific peers, filtered peers). If peer(s) are not specified in options it will default to all peers that belong to client's MSP.
-	err = info.OrgResMgmt.JoinChannel(info.ChannelID, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
+	err = info.OrgResMgmt.JoinChannel(info.ChannelID, resmgmt.WithTargetEndpoints(unjoined...), resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
 	if err != nil {
 		return fmt.Errorf("Peers加入通道失败: %v", err)
 	}
@@ -86,45 +118,231 @@ func CreateChannel(sdk *fabsdk.FabricSDK, info *InitInfo) error {
 	return nil
 }
 
+// 安装并实例化链码
+// 已安装链码的 Peer 不再重复安装, 链码已实例化时跳过实例化
 func InstallAndInstantiateCC(sdk *fabsdk.FabricSDK, info *InitInfo) (*channel.Client, error) {
+	_, err := CreateResMgmtClient(sdk, info)
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := OrgPeers(sdk, info)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("组织 %s 没有配置 Peer 节点", info.OrgName)
+	}
+
+	// 逐个 Peer 查询通道上已实例化的版本, 各 Peer 不一致或与配置的版本不一致时报错, 不自动改用通道上的版本
+	var instantiated string
+	for i, peer := range peers {
+		version, err := InstantiatedVersion(info, peer)
+		if err != nil {
+			return nil, fmt.Errorf("从 %s 查询已实例化的链码失败: %v", peer, err)
+		}
+		if i > 0 && version != instantiated {
+			return nil, fmt.Errorf("各 Peer 上已实例化的链码版本不一致: %s 为 %q, %s 为 %q", peers[0], instantiated, peer, version)
+		}
+		instantiated = version
+	}
+	if instantiated != "" && instantiated != info.Version() {
+		return nil, fmt.Errorf("通道上已实例化的链码版本为 %s, 与配置的版本 %s 不一致, 请执行 ./education upgrade 升级链码, 或将 chaincode.version 改为 %s", instantiated, info.Version(), instantiated)
+	}
+
+	err = installCC(info, peers, info.Version())
+	if err != nil {
+		return nil, err
+	}
+
+	if instantiated == "" {
+		fmt.Println("开始实例化链码......")
+
+		ccPolicy, err := chaincodePolicy(info)
+		if err != nil {
+			return nil, err
+		}
+
+		instantiateCCReq := resmgmt.InstantiateCCRequest{Name: info.ChaincodeID, Path: info.ChaincodePath, Version: info.Version(), Args: [][]byte{[]byte("init")}, Policy: ccPolicy}
+		// instantiates chaincode with optional custom options (specific peers, filtered peers, timeout). If peer(s) are not specified
+		_, err = info.OrgResMgmt.InstantiateCC(info.ChannelID, instantiateCCReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+		if err != nil {
+			return nil, fmt.Errorf("实例化链码失败: %v", err)
+		}
+
+		fmt.Println("链码实例化成功")
+	} else {
+		fmt.Printf("链码 %s:%s 已实例化, 跳过\n", info.ChaincodeID, instantiated)
+	}
+
+	return CreateChannelClient(sdk, info)
+}
+
+// 创建资源管理客户端并保存在 info.OrgResMgmt 中, 用于通道、链码的管理及查询
+func CreateResMgmtClient(sdk *fabsdk.FabricSDK, info *InitInfo) (*resmgmt.Client, error) {
+	if info.OrgResMgmt != nil {
+		return info.OrgResMgmt, nil
+	}
+
+	clientContext := sdk.Context(fabsdk.WithUser(info.OrgAdmin), fabsdk.WithOrg(info.OrgName))
+	if clientContext == nil {
+		return nil, fmt.Errorf("根据指定的组织名称与管理员创建资源管理客户端Context失败")
+	}
+
+	// New returns a resource management client instance.
+	resMgmtClient, err := resmgmt.New(clientContext)
+	if err != nil {
+		return nil, fmt.Errorf("根据指定的资源管理客户端Context创建通道管理客户端失败: %v", err)
+	}
+
+	info.OrgResMgmt = resMgmtClient
+	return resMgmtClient, nil
+}
+
+// 创建应用通道客户端
+func CreateChannelClient(sdk *fabsdk.FabricSDK, info *InitInfo) (*channel.Client, error) {
+	clientChannelContext := sdk.ChannelContext(info.ChannelID, fabsdk.WithUser(info.UserName), fabsdk.WithOrg(info.OrgName))
+	// returns a Client instance. Channel client can query chaincode, execute chaincode and register/unregister for chaincode events on specific channel.
+	channelClient, err := channel.New(clientChannelContext)
+	if err != nil {
+		return nil, fmt.Errorf("创建应用通道客户端失败: %v", err)
+	}
+
+	fmt.Println("通道客户端创建成功，可以利用此客户端调用链码进行查询或执行事务.")
+
+	return channelClient, nil
+}
+
+// 在尚未安装指定版本链码的 Peer 上安装链码
+func installCC(info *InitInfo, peers []string, version string) error {
+	var uninstalled []string
+	for _, peer := range peers {
+		installed, err := chaincodeInstalled(info, peer, version)
+		if err != nil {
+			return fmt.Errorf("查询 %s 已安装的链码失败: %v", peer, err)
+		}
+		if installed {
+			fmt.Printf("%s 已安装链码 %s:%s, 跳过\n", peer, info.ChaincodeID, version)
+			continue
+		}
+		uninstalled = append(uninstalled, peer)
+	}
+
+	if len(uninstalled) == 0 {
+		return nil
+	}
+
 	fmt.Println("开始安装链码......")
 	// creates new go lang chaincode package
 	ccPkg, err := gopackager.NewCCPackage(info.ChaincodePath, info.ChaincodeGoPath)
 	if err != nil {
-		return nil, fmt.Errorf("创建链码包失败: %v", err)
+		return fmt.Errorf("创建链码包失败: %v", err)
 	}
 
 	// contains install chaincode request parameters
-	installCCReq := resmgmt.InstallCCRequest{Name: info.ChaincodeID, Path: info.ChaincodePath, Version: ChaincodeVersion, Package: ccPkg}
+	installCCReq := resmgmt.InstallCCRequest{Name: info.ChaincodeID, Path: info.ChaincodePath, Version: version, Package: ccPkg}
 	// allows administrators to install chaincode onto the filesystem of a peer
-	_, err = info.OrgResMgmt.InstallCC(installCCReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	_, err = info.OrgResMgmt.InstallCC(installCCReq, resmgmt.WithTargetEndpoints(uninstalled...), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
 	if err != nil {
-		return nil, fmt.Errorf("安装链码失败: %v", err)
+		return fmt.Errorf("安装链码失败: %v", err)
 	}
 
 	fmt.Println("指定的链码安装成功")
-	fmt.Println("开始实例化链码......")
+	return nil
+}
 
-	//  returns a policy that requires one valid
-	ccPolicy := cauthdsl.SignedByAnyMember([]string{"org1.kevin.kongyixueyuan.com"})
+// 通过从排序节点获取通道配置判断通道是否已存在
+// 只有排序节点返回 NOT_FOUND 时视为通道不存在, 排序节点不可达、无权限等错误返回给调用方
+func channelExists(info *InitInfo) (bool, error) {
+	_, err := info.OrgResMgmt.QueryConfigFromOrderer(info.ChannelID, resmgmt.WithOrdererEndpoint(info.OrdererOrgName))
+	if err == nil {
+		return true, nil
+	}
+	if s, ok := status.FromError(err); ok && s.Group == status.OrdererServerStatus && s.Code == int32(common.Status_NOT_FOUND) {
+		return false, nil
+	}
+	return false, fmt.Errorf("从排序节点查询通道配置失败: %v", err)
+}
 
-	instantiateCCReq := resmgmt.InstantiateCCRequest{Name: info.ChaincodeID, Path: info.ChaincodePath, Version: ChaincodeVersion, Args: [][]byte{[]byte("init")}, Policy: ccPolicy}
-	// instantiates chaincode with optional custom options (specific peers, filtered peers, timeout). If peer(s) are not specified
-	_, err = info.OrgResMgmt.InstantiateCC(info.ChannelID, instantiateCCReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+// 判断指定的 Peer 是否已加入通道
+func peerJoined(info *InitInfo, peer string) (bool, error) {
+	resp, err := info.OrgResMgmt.QueryChannels(resmgmt.WithTargetEndpoints(peer), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
 	if err != nil {
-		return nil, fmt.Errorf("实例化链码失败: %v", err)
+		return false, err
+	}
+
+	for _, ch := range resp.Channels {
+		if ch.ChannelId == info.ChannelID {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	fmt.Println("链码实例化成功")
+// 判断指定的 Peer 上是否已安装指定版本的链码
+func chaincodeInstalled(info *InitInfo, peer, version string) (bool, error) {
+	resp, err := info.OrgResMgmt.QueryInstalledChaincodes(resmgmt.WithTargetEndpoints(peer), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	if err != nil {
+		return false, err
+	}
 
+	for _, cc := range resp.Chaincodes {
+		if cc.Name == info.ChaincodeID && cc.Version == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 查询通道上已实例化的链码版本, 尚未实例化时返回空字符串
+func InstantiatedVersion(info *InitInfo, peer string) (string, error) {
+	resp, err := info.OrgResMgmt.QueryInstantiatedChaincodes(info.ChannelID, resmgmt.WithTargetEndpoints(peer), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	if err != nil {
+		return "", err
+	}
+
+	for _, cc := range resp.Chaincodes {
+		if cc.Name == info.ChaincodeID {
+			return cc.Version, nil
+		}
+	}
+	return "", nil
+}
+
+// 创建账本客户端, 用于查询区块、交易及链信息
+func CreateLedgerClient(sdk *fabsdk.FabricSDK, info *InitInfo) (*ledger.Client, error) {
 	clientChannelContext := sdk.ChannelContext(info.ChannelID, fabsdk.WithUser(info.UserName), fabsdk.WithOrg(info.OrgName))
-	// returns a Client instance. Channel client can query chaincode, execute chaincode and register/unregister for chaincode events on specific channel.
-	channelClient, err := channel.New(clientChannelContext)
+	// returns a Client instance. Ledger client can query the ledger for blocks, transactions and channel information.
+	ledgerClient, err := ledger.New(clientChannelContext)
 	if err != nil {
-		return nil, fmt.Errorf("创建应用通道客户端失败: %v", err)
+		return nil, fmt.Errorf("创建账本客户端失败: %v", err)
 	}
 
-	fmt.Println("通道客户端创建成功，可以利用此客户端调用链码进行查询或执行事务.")
+	fmt.Println("账本客户端创建成功，可以利用此客户端查询区块及交易信息.")
 
-	return channelClient, nil
+	return ledgerClient, nil
+}
+
+// 创建身份管理客户端, 使用配置文件中的 registrar 在 fabric-ca 中登记、注册及吊销身份
+func CreateMSPClient(sdk *fabsdk.FabricSDK, info *InitInfo) (*mspclient.Client, error) {
+	mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(info.OrgName))
+	if err != nil {
+		return nil, fmt.Errorf("创建身份管理客户端失败: %v", err)
+	}
+	return mspClient, nil
+}
+
+// 根据SDK配置获取指定组织的 Peer 节点名称
+func OrgPeers(sdk *fabsdk.FabricSDK, info *InitInfo) ([]string, error) {
+	ctx, err := sdk.Context(fabsdk.WithUser(info.OrgAdmin), fabsdk.WithOrg(info.OrgName))()
+	if err != nil {
+		return nil, fmt.Errorf("创建客户端Context失败: %v", err)
+	}
+
+	orgConfig, ok := ctx.EndpointConfig().NetworkConfig().Organizations[strings.ToLower(info.OrgName)]
+	if !ok {
+		return nil, fmt.Errorf("配置文件中没有找到组织 %s", info.OrgName)
+	}
+
+	return orgConfig.Peers, nil
 }
@@ -0,0 +1,170 @@
+/**
+  author: kevin
+ */
+
+package sdkInit
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+)
+
+// 私有数据集合的配置, 与 fabric 的 collections_config.json 格式一致
+type CollectionDef struct {
+	Name	string	`json:"name"`
+	Policy	string	`json:"policy"`
+	RequiredPeerCount	int32	`json:"requiredPeerCount"`
+	MaxPeerCount	int32	`json:"maxPeerCount"`
+}
+
+// 升级链码: 在所有 Peer 上安装新版本, 发起升级交易, 并确认所有 Peer 均已使用新版本
+// version 为空时根据当前已实例化的版本自动递增
+// collConfigPath 为可选的私有数据集合配置文件
+func UpgradeCC(sdk *fabsdk.FabricSDK, info *InitInfo, version, collConfigPath string) error {
+	_, err := CreateResMgmtClient(sdk, info)
+	if err != nil {
+		return err
+	}
+
+	peers, err := OrgPeers(sdk, info)
+	if err != nil {
+		return err
+	}
+	if len(peers) == 0 {
+		return fmt.Errorf("组织 %s 没有配置 Peer 节点", info.OrgName)
+	}
+
+	current, err := InstantiatedVersion(info, peers[0])
+	if err != nil {
+		return fmt.Errorf("查询已实例化的链码失败: %v", err)
+	}
+	if current == "" {
+		return fmt.Errorf("链码 %s 尚未实例化, 无法升级", info.ChaincodeID)
+	}
+
+	if version == "" {
+		version, err = NextVersion(current)
+		if err != nil {
+			return err
+		}
+	}
+	if version == current {
+		return fmt.Errorf("链码 %s 当前版本已是 %s", info.ChaincodeID, current)
+	}
+
+	collConfig, err := loadCollectionConfig(collConfigPath)
+	if err != nil {
+		return err
+	}
+
+	ccPolicy, err := chaincodePolicy(info)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("开始将链码 %s 从 %s 升级至 %s......\n", info.ChaincodeID, current, version)
+
+	err = installCC(info, peers, version)
+	if err != nil {
+		return err
+	}
+
+	upgradeCCReq := resmgmt.UpgradeCCRequest{Name: info.ChaincodeID, Path: info.ChaincodePath, Version: version, Args: [][]byte{[]byte("init")}, Policy: ccPolicy, CollConfig: collConfig}
+	_, err = info.OrgResMgmt.UpgradeCC(info.ChannelID, upgradeCCReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	if err != nil {
+		return fmt.Errorf("升级链码失败: %v", err)
+	}
+
+	err = waitForVersion(info, peers, version)
+	if err != nil {
+		return err
+	}
+
+	info.ChaincodeVersion = version
+	fmt.Printf("链码已成功升级至 %s\n", version)
+	return nil
+}
+
+// 将版本号的最后一段数字加一, 如 1.0 -> 1.1
+func NextVersion(version string) (string, error) {
+	parts := strings.Split(version, ".")
+	last, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", fmt.Errorf("无法根据版本号 %s 计算新版本, 请手动指定", version)
+	}
+	parts[len(parts)-1] = strconv.Itoa(last + 1)
+	return strings.Join(parts, "."), nil
+}
+
+// 等待所有 Peer 报告新版本, 提交升级交易后各 Peer 需要一段时间提交区块
+func waitForVersion(info *InitInfo, peers []string, version string) error {
+	for _, peer := range peers {
+		var got string
+		var err error
+		for i := 0; i < 10; i++ {
+			got, err = InstantiatedVersion(info, peer)
+			if err == nil && got == version {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			return fmt.Errorf("查询 %s 上已实例化的链码失败: %v", peer, err)
+		}
+		if got != version {
+			return fmt.Errorf("%s 上的链码版本为 %s, 与升级后的版本 %s 不一致", peer, got, version)
+		}
+		fmt.Printf("%s 已使用链码版本 %s\n", peer, version)
+	}
+	return nil
+}
+
+// 读取私有数据集合配置, 路径为空时返回 nil
+func loadCollectionConfig(path string) ([]*common.CollectionConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取私有数据集合配置失败: %v", err)
+	}
+
+	var defs []CollectionDef
+	err = json.Unmarshal(b, &defs)
+	if err != nil {
+		return nil, fmt.Errorf("解析私有数据集合配置失败: %v", err)
+	}
+
+	var configs []*common.CollectionConfig
+	for _, def := range defs {
+		policy, err := cauthdsl.FromString(def.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("解析私有数据集合 %s 的策略失败: %v", def.Name, err)
+		}
+
+		configs = append(configs, &common.CollectionConfig{
+			Payload: &common.CollectionConfig_StaticCollectionConfig{
+				StaticCollectionConfig: &common.StaticCollectionConfig{
+					Name: def.Name,
+					MemberOrgsPolicy: &common.CollectionPolicyConfig{
+						Payload: &common.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: policy},
+					},
+					RequiredPeerCount: def.RequiredPeerCount,
+					MaximumPeerCount: def.MaxPeerCount,
+				},
+			},
+		})
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,84 @@
+/**
+  author: kevin
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 演示数据, 仅在执行 seed 子命令时写入账本
+var demoEdus = []service.Education{
+	{
+		Name: "张三",
+		Gender: "男",
+		Nation: "汉",
+		EntityID: "101",
+		Place: "北京",
+		BirthDay: "1991年01月01日",
+		EnrollDate: "2009年9月",
+		GraduationDate: "2013年7月",
+		SchoolName: "中国政法大学",
+		Major: "社会学",
+		QuaType: "普通",
+		Length: "四年",
+		Mode: "普通全日制",
+		Level: "本科",
+		Graduation: "毕业",
+		CertNo: "111",
+		Photo: "/static/photo/11.png",
+	},
+	{
+		Name: "李四",
+		Gender: "男",
+		Nation: "汉",
+		EntityID: "102",
+		Place: "上海",
+		BirthDay: "1992年02月01日",
+		EnrollDate: "2010年9月",
+		GraduationDate: "2014年7月",
+		SchoolName: "中国人民大学",
+		Major: "行政管理",
+		QuaType: "普通",
+		Length: "四年",
+		Mode: "普通全日制",
+		Level: "本科",
+		Graduation: "毕业",
+		CertNo: "222",
+		Photo: "/static/photo/22.png",
+	},
+}
+
+// 写入演示数据
+func runSeed(env *appEnv, flags *pflag.FlagSet) error {
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	// 信息须由所属学校的身份签名
+	identities, err := env.identitySetup(serviceSetup)
+	if err != nil {
+		return err
+	}
+
+	for _, edu := range demoEdus {
+		setup, err := identities.SetupForSchool(edu.SchoolName)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		msg, err := setup.SaveEdu(edu)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		fmt.Println("信息发布成功, 交易编号为: " + msg)
+		printTxInfo(serviceSetup, msg)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API 密钥的前缀, 完整格式为 edu_<编号>.<密钥>
+const apiKeyPrefix = "edu_"
+
+var ErrBadAPIKey = errors.New("API 密钥无效或已吊销")
+
+// 供合作方系统调用 API 的密钥, 只保存密钥的 SHA-256 哈希, 明文仅在创建时返回一次
+type APIKey struct {
+	ID	string
+	Name	string	// 用途说明
+	Org	string	// 使用该密钥的机构
+	Role	string	// 调用方具有的角色
+	School	string	`json:",omitempty"`	// 角色为登记员时所属的学校
+	Hash	string
+	CreatedBy	string
+	CreatedAt	time.Time
+	RevokedAt	time.Time	`json:",omitempty"`
+	LastUsedAt	time.Time	`json:",omitempty"`
+	UsageCount	int64
+}
+
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// 保存在本地 JSON 文件中的 API 密钥, 使用次数先在内存中累计, 由 Flush 定期写回文件
+type APIKeyStore struct {
+	Path	string
+
+	mu	sync.Mutex
+	keys	map[string]*APIKey
+	dirty	bool
+}
+
+func OpenAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{Path: path, keys: make(map[string]*APIKey)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 API 密钥文件失败: %v", err)
+	}
+
+	var list []*APIKey
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("解析 API 密钥文件失败: %v", err)
+	}
+	for _, k := range list {
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+// 按创建时间排序返回所有密钥
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, *k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// 创建密钥, 返回的明文密钥不会被保存, 需由调用方转交使用者
+func (s *APIKeyStore) Create(name, org, role, school, createdBy string) (APIKey, string, error) {
+	name, org, school = strings.TrimSpace(name), strings.TrimSpace(org), strings.TrimSpace(school)
+	if name == "" || org == "" {
+		return APIKey{}, "", fmt.Errorf("用途及机构不能为空")
+	}
+	if role == RoleAdmin || role == RoleHolder {
+		return APIKey{}, "", fmt.Errorf("API 密钥不能具有管理员或持证人角色")
+	}
+	if err := validRoles([]string{role}, school, ""); err != nil {
+		return APIKey{}, "", err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	key := &APIKey{
+		ID: id,
+		Name: name,
+		Org: org,
+		Role: role,
+		School: school,
+		Hash: hashSecret(secret),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		return APIKey{}, "", err
+	}
+	return *key, apiKeyPrefix + id + "." + secret, nil
+}
+
+// 吊销密钥, 由该密钥换取的访问令牌同时失效
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("API 密钥 %s 不存在", id)
+	}
+	if k.Revoked() {
+		return fmt.Errorf("API 密钥 %s 已被吊销", id)
+	}
+
+	k.RevokedAt = time.Now()
+	return s.save()
+}
+
+// 校验明文密钥并累计使用次数
+func (s *APIKeyStore) Authenticate(plain string) (APIKey, error) {
+	rest := strings.TrimPrefix(plain, apiKeyPrefix)
+	parts := strings.SplitN(rest, ".", 2)
+	if rest == plain || len(parts) != 2 {
+		return APIKey{}, ErrBadAPIKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[parts[0]]
+	if !ok || k.Revoked() {
+		return APIKey{}, ErrBadAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashSecret(parts[1]))) != 1 {
+		return APIKey{}, ErrBadAPIKey
+	}
+
+	s.touch(k)
+	return *k, nil
+}
+
+// 校验由密钥换取的访问令牌时调用: 密钥必须仍然有效, 并累计使用次数
+func (s *APIKeyStore) Use(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok || k.Revoked() {
+		return APIKey{}, ErrBadAPIKey
+	}
+
+	s.touch(k)
+	return *k, nil
+}
+
+// 调用方需持有锁
+func (s *APIKeyStore) touch(k *APIKey) {
+	k.UsageCount++
+	k.LastUsedAt = time.Now()
+	s.dirty = true
+}
+
+// 将累计的使用次数写回文件
+func (s *APIKeyStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// 将密钥写入文件, 调用方需持有锁
+func (s *APIKeyStore) save() error {
+	list := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存 API 密钥文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("保存 API 密钥文件失败: %v", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
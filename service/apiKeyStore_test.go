@@ -0,0 +1,117 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestKeyStore(t *testing.T) (*APIKeyStore, func()) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenAPIKeyStore(filepath.Join(dir, "apikeys.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	s, cleanup := openTestKeyStore(t)
+	defer cleanup()
+
+	key, plain, err := s.Create("学历核验", "某公司", RoleVerifier, "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, otherPlain, err := s.Create("学历核验", "另一公司", RoleVerifier, "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	secret := plain[strings.Index(plain, ".")+1:]
+
+	tests := []struct {
+		name	string
+		plain	string
+		ok	bool
+	}{
+		{"有效密钥", plain, true},
+		{"缺少前缀", strings.TrimPrefix(plain, apiKeyPrefix), false},
+		{"缺少密钥", apiKeyPrefix + key.ID, false},
+		{"密钥错误", apiKeyPrefix + key.ID + "." + strings.Repeat("0", len(secret)), false},
+		{"以哈希代替密钥", apiKeyPrefix + key.ID + "." + key.Hash, false},
+		{"编号与密钥不匹配", apiKeyPrefix + other.ID + "." + secret, false},
+		{"未知编号", apiKeyPrefix + "0000000000000000." + secret, false},
+		{"已吊销", otherPlain, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Authenticate(tt.plain)
+			if !tt.ok {
+				if err != ErrBadAPIKey {
+					t.Fatalf("Authenticate() 错误为 %v, 应为 ErrBadAPIKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() 失败: %v", err)
+			}
+			if got.ID != key.ID || got.Role != RoleVerifier {
+				t.Fatalf("Authenticate() 返回了错误的密钥 %+v", got)
+			}
+		})
+	}
+}
+
+func TestAPIKeyStoresOnlyHash(t *testing.T) {
+	s, cleanup := openTestKeyStore(t)
+	defer cleanup()
+
+	key, plain, err := s.Create("学历核验", "某公司", RoleVerifier, "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := plain[strings.Index(plain, ".")+1:]
+	if key.Hash != hashSecret(secret) {
+		t.Fatalf("保存的哈希与密钥不一致")
+	}
+
+	b, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), secret) {
+		t.Fatalf("密钥文件中包含明文密钥")
+	}
+
+	// 重新打开后仍可按哈希校验, 使用次数写回文件
+	if _, err := s.Authenticate(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenAPIKeyStore(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Authenticate(plain)
+	if err != nil {
+		t.Fatalf("重新打开后校验失败: %v", err)
+	}
+	if got.UsageCount != 2 {
+		t.Fatalf("使用次数为 %d, 应为 2", got.UsageCount)
+	}
+}
@@ -0,0 +1,154 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 照片的访问地址前缀, 完整地址为 /photos/<摘要>
+const PhotoURLPrefix = "/photos/"
+
+// 照片的上传记录: 对应的缩略图及最近一次上传的时间
+type photoEntry struct {
+	Thumb	string
+	UploadedAt	time.Time
+}
+
+// 附件管理: 照片及其缩略图保存在 BlobStore 中, 本地 JSON 文件记录照片与缩略图的对应关系,
+// 用于清理时保留被引用照片的缩略图
+type Attachments struct {
+	Store	BlobStore
+	Path	string
+
+	mu	sync.Mutex
+	photos	map[string]photoEntry
+}
+
+func OpenAttachments(store BlobStore, path string) (*Attachments, error) {
+	a := &Attachments{Store: store, Path: path, photos: make(map[string]photoEntry)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取附件记录失败: %v", err)
+	}
+	if err := json.Unmarshal(b, &a.photos); err != nil {
+		return nil, fmt.Errorf("解析附件记录失败: %v", err)
+	}
+	return a, nil
+}
+
+// 保存处理后的照片, 返回照片及缩略图的访问地址; 相同的照片只保存一份
+func (a *Attachments) SavePhoto(photo *Photo) (string, string, error) {
+	// 与清理互斥, 避免已存在的文件在记录上传时间前被删除
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	digest, err := a.Store.Put(photo.Data)
+	if err != nil {
+		return "", "", err
+	}
+	thumb, err := a.Store.Put(photo.Thumb)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 重复上传时同样刷新上传时间, 避免刚上传的照片在写入账本前被清理
+	a.photos[digest] = photoEntry{Thumb: thumb, UploadedAt: time.Now()}
+	if err := a.save(); err != nil {
+		return "", "", err
+	}
+	return PhotoURLPrefix + digest, PhotoURLPrefix + thumb, nil
+}
+
+// 从访问地址中取出摘要, 不是本存储的地址时返回 false
+func PhotoDigest(url string) (string, bool) {
+	if !strings.HasPrefix(url, PhotoURLPrefix) {
+		return "", false
+	}
+	digest := strings.TrimPrefix(url, PhotoURLPrefix)
+	return digest, ValidDigest(digest)
+}
+
+// 清理结果
+type GCResult struct {
+	Kept	int
+	Removed	[]BlobInfo
+}
+
+// 删除未被引用的文件: refs 为账本中引用的照片地址, 被引用照片的缩略图同样保留;
+// 上传或写入存储未超过 grace 的文件视为尚未写入账本, 不会删除; dryRun 时只返回将删除的文件
+func (a *Attachments) GC(refs []string, grace time.Duration, dryRun bool) (*GCResult, error) {
+	blobs, err := a.Store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keep := make(map[string]bool)
+	for _, ref := range refs {
+		if digest, ok := PhotoDigest(ref); ok {
+			keep[digest] = true
+			keep[a.photos[digest].Thumb] = true
+		}
+	}
+
+	// 最近上传的照片及其缩略图
+	cutoff := time.Now().Add(-grace)
+	for digest, entry := range a.photos {
+		if entry.UploadedAt.After(cutoff) {
+			keep[digest] = true
+			keep[entry.Thumb] = true
+		}
+	}
+
+	result := &GCResult{}
+	for _, blob := range blobs {
+		if keep[blob.Digest] || blob.ModTime.After(cutoff) {
+			result.Kept++
+			continue
+		}
+		if !dryRun {
+			if err := a.Store.Delete(blob.Digest); err != nil {
+				return result, err
+			}
+			delete(a.photos, blob.Digest)
+		}
+		result.Removed = append(result.Removed, blob)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	return result, a.save()
+}
+
+// 写回附件记录, 调用方需持有锁
+func (a *Attachments) save() error {
+	b, err := json.MarshalIndent(a.photos, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := a.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存附件记录失败: %v", err)
+	}
+	if err := os.Rename(tmp, a.Path); err != nil {
+		return fmt.Errorf("保存附件记录失败: %v", err)
+	}
+	return nil
+}
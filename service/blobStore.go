@@ -0,0 +1,155 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("文件不存在")
+
+// 以内容的 SHA-256 摘要(小写十六进制)为键保存文件, 相同内容只保存一份
+type BlobStore interface {
+	// 保存内容并返回其摘要, 内容已存在时不重复写入
+	Put(data []byte) (string, error)
+	// 读取内容, 不存在时返回 ErrBlobNotFound
+	Open(digest string) (io.ReadCloser, error)
+	// 删除内容, 不存在时不报错
+	Delete(digest string) error
+	// 列出全部内容
+	List() ([]BlobInfo, error)
+}
+
+type BlobInfo struct {
+	Digest	string
+	Size	int64
+	ModTime	time.Time
+}
+
+// 计算内容的摘要
+func BlobDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 摘要须为 64 位小写十六进制, 避免以摘要拼接的路径越出存储目录
+func ValidDigest(digest string) bool {
+	if len(digest) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range digest {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// 本地文件系统存储, 文件按摘要的前两位分目录保存, 如 ab/abcdef...
+type LocalStore struct {
+	Dir	string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %v", err)
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+func (s *LocalStore) path(digest string) string {
+	return filepath.Join(s.Dir, digest[:2], digest)
+}
+
+func (s *LocalStore) Put(data []byte) (string, error) {
+	digest := BlobDigest(data)
+	path := s.path(digest)
+	if _, err := os.Stat(path); err == nil {
+		// 重复上传时刷新修改时间, 避免刚上传的内容在写入账本前被清理
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			return "", fmt.Errorf("保存文件失败: %v", err)
+		}
+		return digest, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("创建存储目录失败: %v", err)
+	}
+
+	// 先写入临时文件再改名, 避免读到写了一半的内容
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("保存文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("保存文件失败: %v", err)
+	}
+	return digest, nil
+}
+
+func (s *LocalStore) Open(digest string) (io.ReadCloser, error) {
+	if !ValidDigest(digest) {
+		return nil, ErrBlobNotFound
+	}
+	f, err := os.Open(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Delete(digest string) error {
+	if !ValidDigest(digest) {
+		return nil
+	}
+	err := os.Remove(s.path(digest))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除文件失败: %v", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) List() ([]BlobInfo, error) {
+	var list []BlobInfo
+	err := filepath.Walk(s.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && ValidDigest(info.Name()) {
+			list = append(list, BlobInfo{Digest: info.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出存储目录失败: %v", err)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].Digest < list[k].Digest })
+	return list, nil
+}
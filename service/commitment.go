@@ -0,0 +1,169 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+)
+
+// 生成加盐哈希承诺的字段, 与链码一致; 照片地址只在系统内部有意义, 不生成承诺
+var CommitFields = []string{"Name", "Gender", "Nation", "EntityID", "Place", "BirthDay", "EnrollDate", "GraduationDate",
+	"SchoolName", "Major", "QuaType", "Length", "Mode", "Level", "Graduation", "CertNo"}
+
+// 字段的承诺: SHA-256(盐值(十六进制) + ":" + 字段名 + ":" + 字段值) 的十六进制
+func Commitment(salt, name, value string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + name + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// 承诺摘要: 按字段名排序的 "字段名:承诺" 以换行连接后的 SHA-256
+func CommitmentRoot(commitments map[string]string) string {
+	names := make([]string, 0, len(commitments))
+	for name := range commitments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ":" + commitments[name]
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// 由密钥派生信息各字段的盐值, 同一身份证号及随机数总是得到相同的盐值, 无需另行保存
+func DeriveSalts(key []byte, entityID, nonce string) map[string]string {
+	salts := make(map[string]string, len(CommitFields))
+	for _, name := range CommitFields {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(entityID + "\n" + nonce + "\n" + name))
+		salts[name] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return salts
+}
+
+// 添加及修改信息时以幂等键作为随机数, 派生的盐值经由 transient 传给链码生成承诺;
+// 重新提交相同幂等键的调用时参数及盐值均不变
+func (t *ServiceSetup) withSalts(key, fcn string, args [][]byte) ([][]byte, map[string][]byte, error) {
+	if len(t.SaltKey) == 0 || (fcn != "addEdu" && fcn != "updateEdu") || len(args) == 0 {
+		return args, nil, nil
+	}
+
+	var edu Education
+	if err := json.Unmarshal(args[0], &edu); err != nil {
+		return nil, nil, fmt.Errorf("指定的edu对象反序列化时发生错误: %v", err)
+	}
+	edu.SaltNonce = key
+	b, err := json.Marshal(edu)
+	if err != nil {
+		return nil, nil, fmt.Errorf("指定的edu对象序列化时发生错误: %v", err)
+	}
+	salts, err := json.Marshal(DeriveSalts(t.SaltKey, edu.EntityID, key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args = append([][]byte{b}, args[1:]...)
+	return args, map[string][]byte{"salts": salts}, nil
+}
+
+// 持证人出示的部分信息: 所选字段的值及盐值, 连同信息的全部承诺
+type Disclosure struct {
+	Root	string	`json:"root"`
+	Commitments	map[string]string	`json:"commitments"`
+	Fields	[]DisclosedValue	`json:"fields"`
+}
+
+type DisclosedValue struct {
+	Name	string	`json:"name"`
+	Value	string	`json:"value"`
+	Salt	string	`json:"salt"`
+}
+
+// 为信息的当前版本生成只包含所选字段的披露包
+func NewDisclosure(edu Education, key []byte, fields []string) (Disclosure, error) {
+	if edu.CommitRoot == "" || edu.SaltNonce == "" {
+		return Disclosure{}, fmt.Errorf("该信息尚未生成承诺, 请联系学校重新提交信息")
+	}
+	if len(key) == 0 {
+		return Disclosure{}, fmt.Errorf("未配置盐值派生密钥")
+	}
+
+	salts := DeriveSalts(key, edu.EntityID, edu.SaltNonce)
+	d := Disclosure{Root: edu.CommitRoot, Commitments: edu.Commitments}
+	for _, name := range CommitFields {
+		for _, f := range fields {
+			if f == name {
+				d.Fields = append(d.Fields, DisclosedValue{Name: name, Value: edu.Field(name), Salt: salts[name]})
+			}
+		}
+	}
+	if len(d.Fields) == 0 {
+		return Disclosure{}, fmt.Errorf("至少选择一项公开的信息")
+	}
+
+	// 密钥变更后派生的盐值与账本中的承诺不再一致
+	if err := d.Verify(); err != nil {
+		return Disclosure{}, fmt.Errorf("盐值与账本中的承诺不一致, 盐值派生密钥可能已变更")
+	}
+	return d, nil
+}
+
+// 离线核验披露包: 承诺摘要与全部承诺一致, 且每个公开的字段与其承诺一致; 不需要访问账本
+func (d Disclosure) Verify() error {
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("披露包中没有公开的字段")
+	}
+	if CommitmentRoot(d.Commitments) != d.Root {
+		return fmt.Errorf("承诺与承诺摘要不一致")
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range d.Fields {
+		want, ok := d.Commitments[f.Name]
+		if !ok || seen[f.Name] {
+			return fmt.Errorf("字段 %s 无效或重复", f.Name)
+		}
+		seen[f.Name] = true
+		if !hmac.Equal([]byte(Commitment(f.Salt, f.Name, f.Value)), []byte(want)) {
+			return fmt.Errorf("字段 %s 的值或盐值与承诺不一致", f.Name)
+		}
+	}
+	return nil
+}
+
+// 账本中承诺摘要对应的承诺及信息状态
+type CommitmentRecord struct {
+	Root	string
+	Commitments	map[string]string
+	TxID	string	// 生成该组承诺的交易
+	Current	bool	// 是否为信息的当前版本
+	Revoked	bool
+	RevokedAt	string	`json:",omitempty"`
+}
+
+// 根据承诺摘要查询承诺及信息状态, 结果中不含信息本身
+func (t *ServiceSetup) FindCommitments(root string) (CommitmentRecord, error) {
+	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: "queryCommitments", Args: [][]byte{[]byte(root)}}
+	respone, err := t.Client.Query(req)
+	if err != nil {
+		return CommitmentRecord{}, err
+	}
+
+	var record CommitmentRecord
+	if err := json.Unmarshal(respone.Payload, &record); err != nil {
+		return CommitmentRecord{}, fmt.Errorf("解析承诺失败: %v", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,189 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"testing"
+)
+
+// 测试使用的学历信息
+func testEdu() Education {
+	return Education{
+		Name: "张小三",
+		Gender: "男",
+		Nation: "汉",
+		EntityID: "101101010101010101",
+		Place: "北京",
+		BirthDay: "1991年01月01日",
+		EnrollDate: "2009年9月",
+		GraduationDate: "2013年7月",
+		SchoolName: "中国政法大学",
+		Major: "民商法学",
+		QuaType: "普通",
+		Length: "四年",
+		Mode: "普通全日制",
+		Level: "本科",
+		Graduation: "毕业",
+		CertNo: "11111111111111",
+		Photo: "/static/photo/11.png",
+	}
+}
+
+// 按链码的方式由盐值生成信息的承诺
+func commitTestEdu(edu *Education, key []byte, nonce string) {
+	salts := DeriveSalts(key, edu.EntityID, nonce)
+	edu.SaltNonce = nonce
+	edu.Commitments = make(map[string]string)
+	for _, name := range CommitFields {
+		edu.Commitments[name] = Commitment(salts[name], name, edu.Field(name))
+	}
+	edu.CommitRoot = CommitmentRoot(edu.Commitments)
+}
+
+// 与链码测试相同的向量, 两端的算法须保持一致
+func TestCommitmentVectors(t *testing.T) {
+	if got := Commitment("00", "Name", "张小三"); got != "cf7e6123427aa66bab352d9a8763aac2734bc7b433f12f273aeb5b4990d451af" {
+		t.Fatalf("Commitment() = %s", got)
+	}
+	if got := CommitmentRoot(map[string]string{"Name": "1", "CertNo": "2"}); got != "88908570ad71e3133f990d9c4d9ca33eb78811039f6da36709f364630b552570" {
+		t.Fatalf("CommitmentRoot() = %s", got)
+	}
+}
+
+func TestCommitmentRoot(t *testing.T) {
+	a := map[string]string{"Name": "1", "CertNo": "2", "Major": "3"}
+	b := map[string]string{"Major": "3", "Name": "1", "CertNo": "2"}
+	if CommitmentRoot(a) != CommitmentRoot(b) {
+		t.Fatalf("承诺摘要与字段顺序有关")
+	}
+
+	tests := []struct {
+		name	string
+		commitments	map[string]string
+	}{
+		{"修改承诺", map[string]string{"Name": "1", "CertNo": "2", "Major": "4"}},
+		{"增加字段", map[string]string{"Name": "1", "CertNo": "2", "Major": "3", "Level": "5"}},
+		{"删除字段", map[string]string{"Name": "1", "CertNo": "2"}},
+		{"交换字段名", map[string]string{"Name": "2", "CertNo": "1", "Major": "3"}},
+		{"承诺中含分隔符", map[string]string{"Name": "1\nCertNo:2", "Major": "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if CommitmentRoot(tt.commitments) == CommitmentRoot(a) {
+				t.Fatalf("不同的承诺得到了相同的摘要")
+			}
+		})
+	}
+}
+
+func TestDeriveSalts(t *testing.T) {
+	key := []byte("salt key")
+	salts := DeriveSalts(key, "101101010101010101", "nonce")
+	if len(salts) != len(CommitFields) {
+		t.Fatalf("派生了 %d 个盐值, 应为 %d", len(salts), len(CommitFields))
+	}
+	seen := make(map[string]bool)
+	for _, name := range CommitFields {
+		if len(salts[name]) != 64 || seen[salts[name]] {
+			t.Fatalf("字段 %s 的盐值 %q 长度错误或与其他字段重复", name, salts[name])
+		}
+		seen[salts[name]] = true
+	}
+
+	again := DeriveSalts(key, "101101010101010101", "nonce")
+	for _, name := range CommitFields {
+		if again[name] != salts[name] {
+			t.Fatalf("相同参数派生的盐值不同")
+		}
+	}
+	for _, other := range []map[string]string{
+		DeriveSalts([]byte("other key"), "101101010101010101", "nonce"),
+		DeriveSalts(key, "101101010101010102", "nonce"),
+		DeriveSalts(key, "101101010101010101", "other nonce"),
+	} {
+		if other["Name"] == salts["Name"] {
+			t.Fatalf("不同参数派生了相同的盐值")
+		}
+	}
+}
+
+func TestDisclosureVerify(t *testing.T) {
+	key := []byte("salt key")
+	edu := testEdu()
+	commitTestEdu(&edu, key, "nonce")
+
+	d, err := NewDisclosure(edu, key, []string{"Name", "SchoolName", "CertNo", "Photo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Fields) != 3 {
+		t.Fatalf("公开了 %d 个字段, 应为 3 个(照片不生成承诺)", len(d.Fields))
+	}
+	if err := d.Verify(); err != nil {
+		t.Fatalf("核验披露包失败: %v", err)
+	}
+
+	// 复制披露包, 修改后不影响原披露包
+	clone := func() Disclosure {
+		c := Disclosure{Root: d.Root, Commitments: make(map[string]string)}
+		for k, v := range d.Commitments {
+			c.Commitments[k] = v
+		}
+		c.Fields = append([]DisclosedValue{}, d.Fields...)
+		return c
+	}
+	tests := []struct {
+		name	string
+		tamper	func(d *Disclosure)
+	}{
+		{"修改字段值", func(d *Disclosure) { d.Fields[0].Value = "李四" }},
+		{"修改盐值", func(d *Disclosure) { d.Fields[0].Salt = d.Fields[1].Salt }},
+		{"冒用其他字段的承诺", func(d *Disclosure) { d.Fields[0].Name = d.Fields[1].Name }},
+		{"重复字段", func(d *Disclosure) { d.Fields = append(d.Fields, d.Fields[0]) }},
+		{"未知字段", func(d *Disclosure) { d.Fields[0].Name = "Photo" }},
+		{"修改承诺", func(d *Disclosure) { d.Commitments["Major"] = Commitment("00", "Major", "法学") }},
+		{"同时修改字段值及其承诺", func(d *Disclosure) {
+			d.Commitments["Name"] = Commitment(d.Fields[0].Salt, "Name", "李四")
+			d.Fields[0].Value = "李四"
+		}},
+		{"修改承诺摘要", func(d *Disclosure) { d.Root = CommitmentRoot(map[string]string{"Name": "1"}) }},
+		{"没有公开的字段", func(d *Disclosure) { d.Fields = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clone()
+			tt.tamper(&c)
+			if err := c.Verify(); err == nil {
+				t.Fatalf("篡改后的披露包核验通过")
+			}
+		})
+	}
+}
+
+func TestNewDisclosure(t *testing.T) {
+	key := []byte("salt key")
+	committed := testEdu()
+	commitTestEdu(&committed, key, "nonce")
+
+	tests := []struct {
+		name	string
+		edu	Education
+		key	[]byte
+		fields	[]string
+	}{
+		{"尚未生成承诺", testEdu(), key, []string{"Name"}},
+		{"未配置密钥", committed, nil, []string{"Name"}},
+		{"密钥已变更", committed, []byte("other key"), []string{"Name"}},
+		{"没有选择字段", committed, key, nil},
+		{"只选择了照片", committed, key, []string{"Photo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDisclosure(tt.edu, tt.key, tt.fields); err == nil {
+				t.Fatalf("NewDisclosure() 应返回错误")
+			}
+		})
+	}
+}
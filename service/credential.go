@@ -0,0 +1,390 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// 可验证凭证中使用的 JSON-LD 上下文及类型
+const (
+	credentialsContext = "https://www.w3.org/2018/credentials/v1"
+	educationVocab = "urn:kongyixueyuan:education#"	// 学历信息字段的词汇表
+	credentialType = "EducationCredential"
+	credentialStatusType = "EducationLedgerStatus"
+	jwtProofType = "JwtProof2020"
+	x509IssuerPrefix = "urn:x509:sha256:"	// 由签名证书 SHA-256 指纹派生的签发者标识
+)
+
+var ErrCredentialMismatch = errors.New("凭证与账本中的信息不一致")
+
+// 学历信息的 W3C 可验证凭证(VC Data Model 1.1, JSON-LD)
+// proof 为以 ES256 签名的 VC-JWT, 载荷中的 vc 声明即不含 proof 的凭证本身
+type Credential struct {
+	Context	[]interface{}	`json:"@context"`
+	ID	string	`json:"id"`
+	Type	[]string	`json:"type"`
+	Issuer	CredentialIssuer	`json:"issuer"`
+	IssuanceDate	string	`json:"issuanceDate"`
+	CredentialSubject	CredentialSubject	`json:"credentialSubject"`
+	CredentialStatus	CredentialStatus	`json:"credentialStatus"`
+	Proof	*CredentialProof	`json:"proof,omitempty"`
+}
+
+type CredentialIssuer struct {
+	ID	string	`json:"id"`	// 学校的 DID 或由签名证书派生的标识
+	Name	string	`json:"name"`	// 学校名称
+}
+
+// 持证人及学历信息, 不含照片
+type CredentialSubject struct {
+	Name	string	`json:"name"`
+	Gender	string	`json:"gender"`
+	Nation	string	`json:"nation"`
+	BirthDate	string	`json:"birthDate"`
+	Place	string	`json:"place"`
+	Identifier	string	`json:"identifier"`	// 身份证号
+	Degree	CredentialDegree	`json:"degree"`
+}
+
+type CredentialDegree struct {
+	Type	string	`json:"type"`
+	SchoolName	string	`json:"schoolName"`
+	Major	string	`json:"major"`
+	Level	string	`json:"level"`
+	QualificationType	string	`json:"qualificationType"`
+	Length	string	`json:"length"`
+	StudyMode	string	`json:"studyMode"`
+	EnrollDate	string	`json:"enrollDate"`
+	GraduationDate	string	`json:"graduationDate"`
+	Graduation	string	`json:"graduation"`
+	CertificateNumber	string	`json:"certificateNumber"`
+}
+
+// 信息在账本中的位置, 核验时据此查询信息的当前状态
+type CredentialStatus struct {
+	ID	string	`json:"id"`
+	Type	string	`json:"type"`
+	TxID	string	`json:"txID"`	// 签发凭证时信息所在的交易
+}
+
+type CredentialProof struct {
+	Type	string	`json:"type"`
+	JWT	string	`json:"jwt"`
+}
+
+// VC-JWT 的声明
+type credentialClaims struct {
+	Issuer	string	`json:"iss"`
+	ID	string	`json:"jti"`
+	NotBefore	int64	`json:"nbf"`
+	VC	json.RawMessage	`json:"vc"`
+}
+
+type jwsHeader struct {
+	Alg	string	`json:"alg"`
+	Typ	string	`json:"typ"`
+	Kid	string	`json:"kid"`
+	X5c	[]string	`json:"x5c"`	// 签名证书(base64 编码的 DER), 核验方据此核验签名并追溯到学校的 CA
+}
+
+// 将学历信息映射为凭证主体
+func NewCredentialSubject(edu Education) CredentialSubject {
+	return CredentialSubject{
+		Name: edu.Name,
+		Gender: edu.Gender,
+		Nation: edu.Nation,
+		BirthDate: edu.BirthDay,
+		Place: edu.Place,
+		Identifier: edu.EntityID,
+		Degree: CredentialDegree{
+			Type: "EducationDegree",
+			SchoolName: edu.SchoolName,
+			Major: edu.Major,
+			Level: edu.Level,
+			QualificationType: edu.QuaType,
+			Length: edu.Length,
+			StudyMode: edu.Mode,
+			EnrollDate: edu.EnrollDate,
+			GraduationDate: edu.GraduationDate,
+			Graduation: edu.Graduation,
+			CertificateNumber: edu.CertNo,
+		},
+	}
+}
+
+// 签发及核验学历信息的可验证凭证, 凭证由信息所属学校的身份签名
+type Credentials struct {
+	SignerFor	func(school string) (*Signer, error)	// 返回学校的签名身份, 其证书须登记该学校
+	Issuers	map[string]string	// 学校名称到其 DID, 未配置的学校使用由签名证书指纹派生的标识
+	Trusted	[]*x509.Certificate	// 核验凭证时信任的学校证书或 CA 证书, 为空时只信任学校当前签名身份的证书
+}
+
+// 学校当前签名身份的证书, 证书中登记的学校须与之一致
+func (c *Credentials) schoolCertificate(school string) (*Signer, *x509.Certificate, error) {
+	signer, err := c.SignerFor(school)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := parseCertificate(signer.Certificate())
+	if err != nil {
+		return nil, nil, err
+	}
+	if s, ok := CertSchool(cert); !ok || s != school {
+		return nil, nil, fmt.Errorf("签名身份不属于学校 %s", school)
+	}
+	return signer, cert, nil
+}
+
+// 为交易 txID 中的信息版本签发凭证
+func (c *Credentials) Issue(edu Education, txID string) (Credential, error) {
+	signer, cert, err := c.schoolCertificate(edu.SchoolName)
+	if err != nil {
+		return Credential{}, err
+	}
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || pub.Curve != elliptic.P256() {
+		return Credential{}, fmt.Errorf("签名证书不是 P-256 ECDSA 证书, 无法以 ES256 签名")
+	}
+	id, err := newUUID()
+	if err != nil {
+		return Credential{}, err
+	}
+
+	issuerID := c.Issuers[edu.SchoolName]
+	if issuerID == "" {
+		issuerID = x509IssuerID(cert)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	vc := Credential{
+		Context: []interface{}{credentialsContext, map[string]string{"@vocab": educationVocab}},
+		ID: "urn:uuid:" + id,
+		Type: []string{"VerifiableCredential", credentialType},
+		Issuer: CredentialIssuer{ID: issuerID, Name: edu.SchoolName},
+		IssuanceDate: now.Format(time.RFC3339),
+		CredentialSubject: NewCredentialSubject(edu),
+		CredentialStatus: CredentialStatus{ID: "urn:fabric:tx:" + txID, Type: credentialStatusType, TxID: txID},
+	}
+
+	b, err := json.Marshal(vc)
+	if err != nil {
+		return Credential{}, err
+	}
+	claims, err := json.Marshal(credentialClaims{Issuer: issuerID, ID: vc.ID, NotBefore: now.Unix(), VC: b})
+	if err != nil {
+		return Credential{}, err
+	}
+	header, err := json.Marshal(jwsHeader{Alg: "ES256", Typ: "JWT", Kid: issuerID + "#key-1", X5c: []string{base64.StdEncoding.EncodeToString(cert.Raw)}})
+	if err != nil {
+		return Credential{}, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	der, err := signer.signBytes([]byte(signingInput))
+	if err != nil {
+		return Credential{}, fmt.Errorf("签名凭证失败: %v", err)
+	}
+	sig, err := es256Signature(der)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	vc.Proof = &CredentialProof{Type: jwtProofType, JWT: signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)}
+	return vc, nil
+}
+
+// 核验凭证的 proof: ES256 签名有效、签名证书可信且属于签发学校, 且 JWT 中的凭证与文档一致; 不访问账本, 返回签名证书
+func (c *Credentials) Verify(vc Credential) (*x509.Certificate, error) {
+	if vc.Proof == nil || vc.Proof.Type != jwtProofType {
+		return nil, fmt.Errorf("凭证缺少 %s 类型的 proof", jwtProofType)
+	}
+	parts := strings.Split(vc.Proof.JWT, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("proof 中的 JWT 格式错误")
+	}
+
+	var header jwsHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("解析 JWT 头部失败: %v", err)
+	}
+	if header.Alg != "ES256" || len(header.X5c) == 0 {
+		return nil, fmt.Errorf("JWT 须以 ES256 签名并在 x5c 中附带签名证书")
+	}
+	der, err := base64.StdEncoding.DecodeString(header.X5c[0])
+	if err != nil {
+		return nil, fmt.Errorf("x5c 格式错误: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名证书失败: %v", err)
+	}
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("签名证书不是 P-256 ECDSA 证书")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, fmt.Errorf("JWT 签名格式错误")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, fmt.Errorf("凭证签名无效")
+	}
+
+	// 签名证书中登记的学校须与签发者及学历信息中的学校一致
+	school, ok := CertSchool(cert)
+	if !ok || school != vc.Issuer.Name || school != vc.CredentialSubject.Degree.SchoolName {
+		return nil, fmt.Errorf("签名证书不属于签发学校 %s", vc.Issuer.Name)
+	}
+
+	trusted := c.Trusted
+	if len(trusted) == 0 {
+		_, own, err := c.schoolCertificate(school)
+		if err != nil {
+			return nil, fmt.Errorf("未知的签发学校 %s: %v", school, err)
+		}
+		trusted = []*x509.Certificate{own}
+	}
+	if err := verifyCertificate(cert, trusted); err != nil {
+		return nil, err
+	}
+
+	var claims credentialClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("解析 JWT 载荷失败: %v", err)
+	}
+	if claims.Issuer != vc.Issuer.ID || claims.ID != vc.ID {
+		return nil, fmt.Errorf("JWT 中的签发者或凭证编号与文档不一致")
+	}
+	if strings.HasPrefix(vc.Issuer.ID, x509IssuerPrefix) && vc.Issuer.ID != x509IssuerID(cert) {
+		return nil, fmt.Errorf("签发者标识与签名证书不一致")
+	}
+	if !strings.HasPrefix(vc.Issuer.ID, x509IssuerPrefix) && vc.Issuer.ID != c.Issuers[school] {
+		return nil, fmt.Errorf("签发者 %s 不是学校 %s 的 DID", vc.Issuer.ID, school)
+	}
+	issued, err := time.Parse(time.RFC3339, vc.IssuanceDate)
+	if err != nil || issued.Unix() != claims.NotBefore {
+		return nil, fmt.Errorf("签发时间与 JWT 不一致")
+	}
+
+	// 文档中除 proof 以外的内容须与 JWT 中签名的凭证完全一致
+	vc.Proof = nil
+	b, err := json.Marshal(vc)
+	if err != nil {
+		return nil, err
+	}
+	var got, signed interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(claims.VC, &signed); err != nil {
+		return nil, fmt.Errorf("解析 JWT 中的凭证失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, signed) {
+		return nil, fmt.Errorf("凭证内容与签名不一致, 可能已被篡改")
+	}
+	return cert, nil
+}
+
+// 凭证对应的信息在账本中的状态
+type CredentialState struct {
+	Current	bool	// 信息此后未被修改
+	Revoked	bool
+	RevokedAt	string
+}
+
+// 在账本中查询凭证对应的信息, 核对签发时的信息版本与凭证一致, 并返回信息的当前状态
+func (t *ServiceSetup) CheckCredential(vc Credential) (CredentialState, error) {
+	result, err := t.FindEduInfoByEntityID(vc.CredentialSubject.Identifier)
+	if err != nil {
+		return CredentialState{}, err
+	}
+	var edu Education
+	if err := json.Unmarshal(result, &edu); err != nil {
+		return CredentialState{}, fmt.Errorf("反序列化edu信息失败: %v", err)
+	}
+
+	for _, item := range edu.Historys {
+		if item.TxId != vc.CredentialStatus.TxID {
+			continue
+		}
+		if !reflect.DeepEqual(NewCredentialSubject(item.Education), vc.CredentialSubject) {
+			return CredentialState{}, ErrCredentialMismatch
+		}
+		return CredentialState{
+			Current: reflect.DeepEqual(NewCredentialSubject(edu), vc.CredentialSubject),
+			Revoked: edu.Revoked,
+			RevokedAt: edu.RevokedAt,
+		}, nil
+	}
+	return CredentialState{}, ErrCredentialMismatch
+}
+
+// 随机生成的 UUID(版本 4)
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// 由证书的 SHA-256 指纹派生的签发者标识
+func x509IssuerID(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return x509IssuerPrefix + hex.EncodeToString(sum[:])
+}
+
+func parseCertificate(data string) (*x509.Certificate, error) {
+	certs, err := ParseCertificates([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("解析签名证书失败: %v", err)
+	}
+	return certs[0], nil
+}
+
+// 将 DER 格式的 ECDSA 签名转换为 JWS 使用的 R||S 格式, 各 32 字节
+func es256Signature(der []byte) ([]byte, error) {
+	var sig struct {
+		R, S	*big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("解析签名失败: %v", err)
+	}
+	r, sb := sig.R.Bytes(), sig.S.Bytes()
+	if len(r) > 32 || len(sb) > 32 {
+		return nil, fmt.Errorf("签名格式错误")
+	}
+	// 左侧补零至 32 字节
+	b := make([]byte, 64)
+	copy(b[32-len(r):32], r)
+	copy(b[64-len(sb):], sb)
+	return b, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,226 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// 各学校的签名身份由同一 CA 签发
+func newTestCredentials(t *testing.T, ca *testCA, schools ...string) *Credentials {
+	signers := make(map[string]*Signer)
+	for _, school := range schools {
+		signers[school] = newTestSigner(t, ca, school)
+	}
+	return &Credentials{
+		SignerFor: func(school string) (*Signer, error) {
+			s, ok := signers[school]
+			if !ok {
+				return nil, fmt.Errorf("学校 %s 没有签名身份", school)
+			}
+			return s, nil
+		},
+		Issuers: make(map[string]string),
+	}
+}
+
+func issueTestCredential(t *testing.T, c *Credentials, edu Education) Credential {
+	vc, err := c.Issue(edu, "txid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vc
+}
+
+func TestCredentialIssueVerify(t *testing.T) {
+	ca := newTestCA(t)
+	c := newTestCredentials(t, ca, "中国政法大学", "北京大学")
+	c.Issuers["北京大学"] = "did:web:pku.edu.cn"
+
+	edu := testEdu()
+	vc := issueTestCredential(t, c, edu)
+	if !strings.HasPrefix(vc.Issuer.ID, x509IssuerPrefix) || vc.Issuer.Name != edu.SchoolName {
+		t.Fatalf("签发者为 %+v", vc.Issuer)
+	}
+	pku := testEdu()
+	pku.SchoolName = "北京大学"
+	pkuVC := issueTestCredential(t, c, pku)
+	if pkuVC.Issuer.ID != "did:web:pku.edu.cn" {
+		t.Fatalf("签发者应为学校的 DID, 实际为 %s", pkuVC.Issuer.ID)
+	}
+
+	// 学校更换签名身份后, 未配置信任证书时只信任学校当前的证书
+	rotated := newTestCredentials(t, ca, "中国政法大学")
+	trustCA := newTestCredentials(t, ca, "中国政法大学")
+	trustCA.Trusted = []*x509.Certificate{ca.cert}
+	trustOther := newTestCredentials(t, ca, "中国政法大学")
+	trustOther.Trusted = []*x509.Certificate{newTestCA(t).cert}
+	otherDID := newTestCredentials(t, ca, "北京大学")
+	otherDID.Issuers["北京大学"] = "did:web:other.example"
+
+	// 修改凭证后核验, 不影响原凭证
+	modify := func(vc Credential, f func(vc *Credential)) Credential {
+		vc.Proof = &CredentialProof{Type: vc.Proof.Type, JWT: vc.Proof.JWT}
+		f(&vc)
+		return vc
+	}
+	parts := strings.Split(vc.Proof.JWT, ".")
+
+	tests := []struct {
+		name	string
+		c	*Credentials
+		vc	Credential
+		ok	bool
+	}{
+		{"证书派生的签发者", c, vc, true},
+		{"学校的 DID", c, pkuVC, true},
+		{"信任学校的 CA", trustCA, vc, true},
+		{"不信任的 CA", trustOther, vc, false},
+		{"学校已更换签名身份", rotated, vc, false},
+		{"修改持证人姓名", c, modify(vc, func(vc *Credential) { vc.CredentialSubject.Name = "李四" }), false},
+		{"修改证书编号", c, modify(vc, func(vc *Credential) { vc.CredentialSubject.Degree.CertificateNumber = "2" }), false},
+		{"修改凭证状态", c, modify(vc, func(vc *Credential) { vc.CredentialStatus.TxID = "other" }), false},
+		{"修改学历中的学校", c, modify(vc, func(vc *Credential) { vc.CredentialSubject.Degree.SchoolName = "北京大学" }), false},
+		{"修改签发学校名称", c, modify(vc, func(vc *Credential) { vc.Issuer.Name = "北京大学" }), false},
+		{"冒用其他学校的签发者", c, modify(pkuVC, func(vc *Credential) { vc.Issuer.ID = "did:web:cupl.edu.cn" }), false},
+		{"签发者不是学校的 DID", otherDID, pkuVC, false},
+		{"签发者与签名证书不一致", c, modify(vc, func(vc *Credential) { vc.Issuer.ID = x509IssuerPrefix + strings.Repeat("0", 64) }), false},
+		{"修改签发时间", c, modify(vc, func(vc *Credential) { vc.IssuanceDate = "2000-01-01T00:00:00Z" }), false},
+		{"缺少 proof", c, modify(vc, func(vc *Credential) { vc.Proof = nil }), false},
+		{"proof 类型错误", c, modify(vc, func(vc *Credential) { vc.Proof.Type = "Ed25519Signature2018" }), false},
+		{"JWT 格式错误", c, modify(vc, func(vc *Credential) { vc.Proof.JWT = parts[0] + "." + parts[1] }), false},
+		{"签名被截断", c, modify(vc, func(vc *Credential) { vc.Proof.JWT = vc.Proof.JWT[:len(vc.Proof.JWT)-2] }), false},
+		{"签名与载荷不一致", c, modify(vc, func(vc *Credential) { vc.Proof.JWT = parts[0] + "." + strings.Split(pkuVC.Proof.JWT, ".")[1] + "." + parts[2] }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := tt.c.Verify(tt.vc)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Verify() 错误为 %v", err)
+			}
+			if tt.ok {
+				if school, _ := CertSchool(cert); school != tt.vc.Issuer.Name {
+					t.Fatalf("签名证书属于学校 %s", school)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialIssueSchool(t *testing.T) {
+	ca := newTestCA(t)
+	c := newTestCredentials(t, ca, "中国政法大学")
+	// 学校的签名身份登记了其他学校
+	wrong := newTestSigner(t, ca, "北京大学")
+	c2 := &Credentials{SignerFor: func(string) (*Signer, error) { return wrong, nil }}
+
+	tests := []struct {
+		name	string
+		c	*Credentials
+		school	string
+	}{
+		{"学校没有签名身份", c, "北京大学"},
+		{"签名身份不属于该学校", c2, "中国政法大学"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edu := testEdu()
+			edu.SchoolName = tt.school
+			if _, err := tt.c.Issue(edu, "txid"); err == nil {
+				t.Fatalf("Issue() 应返回错误")
+			}
+		})
+	}
+}
+
+// R 或 S 不足 32 字节的签名须左侧补零后仍可核验
+func TestCredentialShortSignatureHalves(t *testing.T) {
+	ca := newTestCA(t)
+	c := newTestCredentials(t, ca, "中国政法大学")
+
+	for i := 0; i < 5000; i++ {
+		vc := issueTestCredential(t, c, testEdu())
+		parts := strings.Split(vc.Proof.JWT, ".")
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || len(sig) != 64 {
+			t.Fatalf("JWT 签名长度为 %d", len(sig))
+		}
+		if sig[0] != 0 && sig[32] != 0 {
+			continue
+		}
+		if _, err := c.Verify(vc); err != nil {
+			t.Fatalf("R 或 S 不足 32 字节时核验失败: %v", err)
+		}
+		return
+	}
+	t.Fatalf("未生成 R 或 S 不足 32 字节的签名")
+}
+
+func TestES256Signature(t *testing.T) {
+	der := func(r, s *big.Int) []byte {
+		b, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	tooLong := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	tests := []struct {
+		name	string
+		der	[]byte
+		r, s	*big.Int
+		ok	bool
+	}{
+		{"R 及 S 均为 32 字节", der(max, max), max, max, true},
+		{"R 只有 1 字节", der(big.NewInt(1), max), big.NewInt(1), max, true},
+		{"S 只有 2 字节", der(max, big.NewInt(0x0100)), max, big.NewInt(0x0100), true},
+		{"R 超过 32 字节", der(tooLong, big.NewInt(1)), nil, nil, false},
+		{"S 超过 32 字节", der(big.NewInt(1), tooLong), nil, nil, false},
+		{"不是 DER", []byte("signature"), nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := es256Signature(tt.der)
+			if (err == nil) != tt.ok {
+				t.Fatalf("es256Signature() 错误为 %v", err)
+			}
+			if !tt.ok {
+				return
+			}
+			if len(sig) != 64 {
+				t.Fatalf("签名长度为 %d", len(sig))
+			}
+			if new(big.Int).SetBytes(sig[:32]).Cmp(tt.r) != 0 || new(big.Int).SetBytes(sig[32:]).Cmp(tt.s) != 0 {
+				t.Fatalf("R 或 S 的值错误: %x", sig)
+			}
+		})
+	}
+
+	// 转换后的签名可由公钥核验
+	key := newTestKey(t)
+	digest := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := es256Signature(der(r, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Fatalf("转换后的签名核验失败")
+	}
+}
@@ -0,0 +1,94 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// 学历信息中可由持证人选择公开的字段
+type EduField struct {
+	Name	string	// Education 的字段名
+	Label	string
+}
+
+// 可公开的字段, 按展示顺序排列; 学校名称始终公开, 不在其中
+var DisclosableFields = []EduField{
+	{"Name", "姓名"},
+	{"Gender", "性别"},
+	{"BirthDay", "出生日期"},
+	{"EntityID", "身份证号"},
+	{"Nation", "民族"},
+	{"Place", "籍贯"},
+	{"Photo", "照片"},
+	{"EnrollDate", "入学日期"},
+	{"GraduationDate", "毕(结)业日期"},
+	{"Major", "专业"},
+	{"Length", "学制"},
+	{"Level", "层次"},
+	{"QuaType", "学历类别"},
+	{"Mode", "学习形式"},
+	{"Graduation", "毕(结)业"},
+	{"CertNo", "证书编号"},
+}
+
+// 全部可公开字段的名称, 备案表的验证码公开全部字段
+func AllFields() []string {
+	names := make([]string, len(DisclosableFields))
+	for i, f := range DisclosableFields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// 校验所选的字段, 去除重复并按展示顺序排列
+func ValidFields(names []string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := fieldLabel(name); !ok {
+			return nil, fmt.Errorf("未知的字段: %s", name)
+		}
+		selected[name] = true
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("至少选择一项公开的信息")
+	}
+
+	var list []string
+	for _, f := range DisclosableFields {
+		if selected[f.Name] {
+			list = append(list, f.Name)
+		}
+	}
+	return list, nil
+}
+
+// 字段的中文名称
+func FieldLabel(name string) string {
+	if name == "SchoolName" {
+		return "学校名称"
+	}
+	label, _ := fieldLabel(name)
+	return label
+}
+
+func fieldLabel(name string) (string, bool) {
+	for _, f := range DisclosableFields {
+		if f.Name == name {
+			return f.Label, true
+		}
+	}
+	return "", false
+}
+
+// 按字段名取信息中的字符串字段, 未知的字段返回空串
+func (e Education) Field(name string) string {
+	v := reflect.ValueOf(e).FieldByName(name)
+	if !v.IsValid() || v.Kind() != reflect.String {
+		return ""
+	}
+	return v.String()
+}
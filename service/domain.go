@@ -5,9 +5,8 @@ package service
 
 import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
-	"fmt"
-	"time"
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 )
 
 type Education struct {
@@ -31,34 +30,74 @@ type Education struct {
 
 	Photo	string	`json:"Photo"`	// 照片
 
-	Historys	[]HistoryItem	// 当前edu的历史记录
+	Revoked	bool	`json:"Revoked,omitempty"`	// 是否已撤销
+	RevokeReason	string	`json:"RevokeReason,omitempty"`	// 撤销原因
+	RevokedAt	string	`json:"RevokedAt,omitempty"`	// 撤销时间(交易时间, RFC 3339)
+	RevokedBy	string	`json:"RevokedBy,omitempty"`	// 撤销者: 提交撤销交易的账号或证书 CN
+
+	SaltNonce	string	`json:"SaltNonce,omitempty"`	// 派生各字段盐值的随机数
+	Commitments	map[string]string	`json:"Commitments,omitempty"`	// 各字段的加盐哈希承诺, 由链码生成
+	CommitRoot	string	`json:"CommitRoot,omitempty"`	// 全部承诺的摘要
+
+	Signature	string	`json:"Signature,omitempty"`	// 学校对信息规范化序列化的签名(base64)
+	SignerCert	string	`json:"SignerCert,omitempty"`	// 签名身份的证书(PEM)
+
+	Historys	[]HistoryItem	`json:",omitempty"`	// 当前edu的历史记录
 }
 
 type HistoryItem struct {
 	TxId	string
 	Education	Education
+
+	TxInfo	*TxInfo	`json:",omitempty"`	// 交易所在区块、时间戳及背书信息
 }
 
 type ServiceSetup struct {
 	ChaincodeID	string
 	Client	*channel.Client
+	Ledger	*ledger.Client
+	Endorsers	[]string	// 背书策略所涉及组织的 Peer, 为空时由SDK选择
+	Owner	string	// 签名交易的 Web 账号, 为空时为默认身份
+	Outbox	*Outbox	// 发送交易前记录调用的发件箱, 为空时直接调用链码
+	SaltKey	[]byte	// 派生各字段盐值的密钥, 为空时不生成承诺
+	Signer	*Signer	// 签名学历信息的学校身份, 为空时不签名, 链码将拒绝添加及修改
 }
 
-func regitserEvent(client *channel.Client, chaincodeID, eventID string) (fab.Registration, <-chan *fab.CCEvent) {
-
-	reg, notifier, err := client.RegisterChaincodeEvent(chaincodeID, eventID)
-	if err != nil {
-		fmt.Println("注册链码事件失败: %s", err)
+// 调用链码时的请求选项, 指定了背书节点时向这些节点发送背书请求
+func (t *ServiceSetup) executeOptions() []channel.RequestOption {
+	if len(t.Endorsers) == 0 {
+		return nil
 	}
-	return reg, notifier
+	return []channel.RequestOption{channel.WithTargetEndpoints(t.Endorsers...)}
 }
 
-func eventResult(notifier <-chan *fab.CCEvent, eventID string) error {
-	select {
-	case ccEvent := <-notifier:
-		fmt.Printf("接收到链码事件: %v\n", ccEvent)
-	case <-time.After(time.Second * 20):
-		return fmt.Errorf("不能根据指定的事件ID接收到相应的链码事件(%s)", eventID)
+// 背书完成后、向排序服务提交交易前调用 endorsed, 此时交易编号已确定
+type endorsedHandler struct {
+	endorsed	func(txID string)
+	next	invoke.Handler
+}
+
+func (h *endorsedHandler) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	if h.endorsed != nil {
+		h.endorsed(string(requestContext.Response.TransactionID))
 	}
-	return nil
+	h.next.Handle(requestContext, clientContext)
+}
+
+// 调用链码并等待交易提交到账本, 与 Execute 相同, 但在背书完成时通过 endorsed 通知调用方
+// transient 中的数据只发送给背书节点, 不会写入交易
+func (t *ServiceSetup) invoke(fcn string, args [][]byte, transient map[string][]byte, endorsed func(txID string)) (string, error) {
+	handler := invoke.NewProposalProcessorHandler(
+		invoke.NewEndorsementHandler(
+			invoke.NewEndorsementValidationHandler(
+				invoke.NewSignatureValidationHandler(
+					&endorsedHandler{endorsed: endorsed, next: invoke.NewCommitHandler()},
+				),
+			),
+		),
+	)
+
+	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: fcn, Args: args, TransientMap: transient}
+	respone, err := t.Client.InvokeHandler(handler, req, t.executeOptions()...)
+	return string(respone.TransactionID), err
 }
@@ -0,0 +1,71 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+)
+
+// CSV 导入导出时使用的列, 与 Education 的 JSON 字段名一致
+var EduCSVHeader = []string{
+	"Name", "Gender", "Nation", "EntityID", "Place", "BirthDay",
+	"EnrollDate", "GraduationDate", "SchoolName", "Major", "QuaType",
+	"Length", "Mode", "Level", "Graduation", "CertNo", "Photo",
+}
+
+// 字段名与 Education 中对应字段的映射
+func (edu *Education) fields() map[string]*string {
+	return map[string]*string{
+		"Name":           &edu.Name,
+		"Gender":         &edu.Gender,
+		"Nation":         &edu.Nation,
+		"EntityID":       &edu.EntityID,
+		"Place":          &edu.Place,
+		"BirthDay":       &edu.BirthDay,
+		"EnrollDate":     &edu.EnrollDate,
+		"GraduationDate": &edu.GraduationDate,
+		"SchoolName":     &edu.SchoolName,
+		"Major":          &edu.Major,
+		"QuaType":        &edu.QuaType,
+		"Length":         &edu.Length,
+		"Mode":           &edu.Mode,
+		"Level":          &edu.Level,
+		"Graduation":     &edu.Graduation,
+		"CertNo":         &edu.CertNo,
+		"Photo":          &edu.Photo,
+	}
+}
+
+// 按 EduCSVHeader 的顺序输出一行
+func (edu Education) CSVRecord() []string {
+	fields := edu.fields()
+	record := make([]string, len(EduCSVHeader))
+	for i, name := range EduCSVHeader {
+		record[i] = *fields[name]
+	}
+	return record
+}
+
+// 根据表头将一行 CSV 转换为 Education, 未知的列将报错
+func EduFromCSVRecord(header, record []string) (Education, error) {
+	var edu Education
+	if len(header) != len(record) {
+		return edu, fmt.Errorf("列数 %d 与表头列数 %d 不一致", len(record), len(header))
+	}
+
+	fields := edu.fields()
+	for i, name := range header {
+		p, ok := fields[name]
+		if !ok {
+			return edu, fmt.Errorf("未知的列: %s", name)
+		}
+		*p = record[i]
+	}
+
+	if edu.EntityID == "" {
+		return edu, fmt.Errorf("身份证号不能为空")
+	}
+	return edu, nil
+}
@@ -11,10 +11,15 @@ import (
 )
 
 func (t *ServiceSetup) SaveEdu(edu Education) (string, error) {
+	key, err := NewIdempotencyKey()
+	if err != nil {
+		return "", err
+	}
+	return t.SaveEduOnce(key, edu)
+}
 
-	eventID := "eventAddEdu"
-	reg, notifier := regitserEvent(t.Client, t.ChaincodeID, eventID)
-	defer t.Client.UnregisterChaincodeEvent(reg)
+// 以幂等键 key 添加信息, 相同的键只会写入账本一次, 重复调用时返回首次写入的交易编号
+func (t *ServiceSetup) SaveEduOnce(key string, edu Education) (string, error) {
 
 	// 将edu对象序列化成为字节数组
 	b, err := json.Marshal(edu)
@@ -22,18 +27,7 @@ func (t *ServiceSetup) SaveEdu(edu Education) (string, error) {
 		return "", fmt.Errorf("指定的edu对象序列化时发生错误")
 	}
 
-	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: "addEdu", Args: [][]byte{b, []byte(eventID)}}
-	respone, err := t.Client.Execute(req)
-	if err != nil {
-		return "", err
-	}
-
-	err = eventResult(notifier, eventID)
-	if err != nil {
-		return "", err
-	}
-
-	return string(respone.TransactionID), nil
+	return t.submit(key, "addEdu", [][]byte{b, []byte("eventAddEdu")}, nil)
 }
 
 
@@ -59,49 +53,64 @@ func (t *ServiceSetup) FindEduByCertNoAndName(certNo, name string) ([]byte, erro
 	return respone.Payload, nil
 }
 
-func (t *ServiceSetup) ModifyEdu(edu Education) (string, error) {
-
-	eventID := "eventModifyEdu"
-	reg, notifier := regitserEvent(t.Client, t.ChaincodeID, eventID)
-	defer t.Client.UnregisterChaincodeEvent(reg)
+// 账本中引用的全部照片地址(含历史版本)
+func (t *ServiceSetup) FindPhotoRefs() ([]string, error) {
 
-	// 将edu对象序列化成为字节数组
-	b, err := json.Marshal(edu)
+	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: "queryPhotos"}
+	respone, err := t.Client.Query(req)
 	if err != nil {
-		return "", fmt.Errorf("指定的edu对象序列化时发生错误")
+		return nil, err
 	}
 
-	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: "updateEdu", Args: [][]byte{b, []byte(eventID)}}
-	respone, err := t.Client.Execute(req)
+	var refs []string
+	if err := json.Unmarshal(respone.Payload, &refs); err != nil {
+		return nil, fmt.Errorf("解析照片列表失败: %v", err)
+	}
+	return refs, nil
+}
+
+func (t *ServiceSetup) ModifyEdu(edu Education) (string, error) {
+	key, err := NewIdempotencyKey()
 	if err != nil {
 		return "", err
 	}
+	return t.ModifyEduOnce(key, edu)
+}
 
-	err = eventResult(notifier, eventID)
+// 以幂等键 key 修改信息
+func (t *ServiceSetup) ModifyEduOnce(key string, edu Education) (string, error) {
+
+	// 将edu对象序列化成为字节数组
+	b, err := json.Marshal(edu)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("指定的edu对象序列化时发生错误")
 	}
 
-	return string(respone.TransactionID), nil
+	return t.submit(key, "updateEdu", [][]byte{b, []byte("eventModifyEdu")}, nil)
 }
 
 func (t *ServiceSetup) DelEdu(entityID string) (string, error) {
-
-	eventID := "eventDelEdu"
-	reg, notifier := regitserEvent(t.Client, t.ChaincodeID, eventID)
-	defer t.Client.UnregisterChaincodeEvent(reg)
-
-	req := channel.Request{ChaincodeID: t.ChaincodeID, Fcn: "delEdu", Args: [][]byte{[]byte(entityID), []byte(eventID)}}
-	respone, err := t.Client.Execute(req)
+	key, err := NewIdempotencyKey()
 	if err != nil {
 		return "", err
 	}
+	return t.DelEduOnce(key, entityID)
+}
 
-	err = eventResult(notifier, eventID)
+// 以幂等键 key 删除信息
+func (t *ServiceSetup) DelEduOnce(key string, entityID string) (string, error) {
+	return t.submit(key, "delEdu", [][]byte{[]byte(entityID), []byte("eventDelEdu")}, nil)
+}
+
+func (t *ServiceSetup) RevokeEdu(entityID, reason string) (string, error) {
+	key, err := NewIdempotencyKey()
 	if err != nil {
 		return "", err
 	}
-
-	return string(respone.TransactionID), nil
+	return t.RevokeEduOnce(key, entityID, reason)
 }
 
+// 以幂等键 key 撤销信息, 撤销后信息仍可查询并标记为已撤销
+func (t *ServiceSetup) RevokeEduOnce(key, entityID, reason string) (string, error) {
+	return t.submit(key, "revokeEdu", [][]byte{[]byte(entityID), []byte(reason), []byte("eventRevokeEdu")}, nil)
+}
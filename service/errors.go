@@ -0,0 +1,91 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"strings"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	grpcCodes "google.golang.org/grpc/codes"
+)
+
+// 链码以错误信息的形式返回查询结果为空及身份证号重复, 根据其中的关键字判断错误类型
+
+// 根据身份证号或证书编号及姓名没有查询到信息
+func IsNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "没有查询到相关的信息")
+}
+
+// 要添加的身份证号码已存在
+func IsExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "已存在")
+}
+
+// 提取链码或节点返回的错误描述, 去掉 SDK 附加的状态码等信息, 便于直接展示给用户
+func ErrorMessage(err error) string {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err.Error()
+	}
+
+	// 多个背书节点同时返回错误时, 取第一个节点的描述
+	if s.Group == status.ClientStatus && s.Code == status.MultipleErrors.ToInt32() {
+		for _, detail := range s.Details {
+			if e, ok := detail.(error); ok {
+				return ErrorMessage(e)
+			}
+		}
+	}
+	return s.Message
+}
+
+// 可自动重试的暂时性错误: 读写冲突及排序服务、节点暂时不可用
+var transientCodes = map[status.Group][]status.Code{
+	status.EventServerStatus: {
+		status.Code(pb.TxValidationCode_MVCC_READ_CONFLICT),
+		status.Code(pb.TxValidationCode_PHANTOM_READ_CONFLICT),
+	},
+	status.OrdererClientStatus: {
+		status.ConnectionFailed,
+	},
+	status.OrdererServerStatus: {
+		status.Code(common.Status_SERVICE_UNAVAILABLE),
+		status.Code(common.Status_INTERNAL_SERVER_ERROR),
+	},
+	status.EndorserClientStatus: {
+		status.ConnectionFailed,
+	},
+	status.EndorserServerStatus: {
+		status.Code(common.Status_SERVICE_UNAVAILABLE),
+	},
+	status.GRPCTransportStatus: {
+		status.Code(grpcCodes.Unavailable),
+	},
+}
+
+// 判断交易失败是否为暂时性错误, 重新提交可能成功
+func IsTransient(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || err == nil {
+		return false
+	}
+
+	if s.Group == status.ClientStatus && s.Code == status.MultipleErrors.ToInt32() {
+		for _, detail := range s.Details {
+			if e, ok := detail.(error); ok && IsTransient(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, code := range transientCodes[s.Group] {
+		if s.Code == int32(code) {
+			return true
+		}
+	}
+	return false
+}
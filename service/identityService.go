@@ -0,0 +1,276 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// Fabric 身份的状态
+const (
+	IdentityActive = "active"
+	IdentityRevoked = "revoked"
+)
+
+// 吊销证书时提交给 fabric-ca 的原因, 取值见 golang.org/x/crypto/ocsp
+const revokeReason = "cessationofoperation"
+
+// Web 账号对应的 Fabric 身份
+type Identity struct {
+	Owner	string	// Web 账号的登录名
+	EnrollID	string	// 在 fabric-ca 中登记的名称
+	School	string	`json:",omitempty"`	// 登记在证书中的所属学校, 签名的信息须属于该学校
+	Status	string
+	EnrolledAt	time.Time
+	RevokedAt	time.Time	`json:",omitempty"`
+	RevokeNote	string	`json:",omitempty"`	// 吊销原因, 随吊销的证书记录到账本中
+	Unrecorded	[]msp.RevokedCert	`json:",omitempty"`	// 已在 fabric-ca 吊销但尚未记录到账本中的证书
+}
+
+// 身份管理: 通过 fabric-ca 为每个 Web 账号登记、注册及吊销 Fabric 身份
+// 每个身份使用各自的通道客户端签名交易, 客户端创建后被缓存
+type IdentitySetup struct {
+	SDK	*fabsdk.FabricSDK
+	MSP	*msp.Client	// 使用配置文件中的 registrar 访问 fabric-ca
+	ChannelID	string
+	OrgName	string
+	Affiliation	string	// 新身份所属的部门, 如 org1
+	Default	*ServiceSetup	// 尚未登记 Fabric 身份的账号使用的默认身份
+	StorePath	string	// 身份记录文件
+
+	mu	sync.Mutex
+	identities	map[string]*Identity	// 以 Web 账号为键
+	setups	map[string]*ServiceSetup
+}
+
+// 读取身份记录, 文件不存在时视为没有任何记录
+func (t *IdentitySetup) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.identities = make(map[string]*Identity)
+	t.setups = make(map[string]*ServiceSetup)
+
+	b, err := ioutil.ReadFile(t.StorePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取身份记录失败: %v", err)
+	}
+
+	var list []*Identity
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("解析身份记录失败: %v", err)
+	}
+	for _, id := range list {
+		t.identities[id.Owner] = id
+	}
+	return nil
+}
+
+// 将身份记录写入文件, 调用方需持有锁
+func (t *IdentitySetup) save() error {
+	list := make([]*Identity, 0, len(t.identities))
+	for _, id := range t.identities {
+		list = append(list, id)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Owner < list[j].Owner })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := t.StorePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存身份记录失败: %v", err)
+	}
+	if err := os.Rename(tmp, t.StorePath); err != nil {
+		return fmt.Errorf("保存身份记录失败: %v", err)
+	}
+	return nil
+}
+
+// 查询 Web 账号对应的 Fabric 身份, 未登记时返回 nil
+func (t *IdentitySetup) Identity(owner string) *Identity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id, ok := t.identities[owner]; ok {
+		result := *id
+		return &result
+	}
+	return nil
+}
+
+// 在 fabric-ca 中登记并注册新身份, 私钥及证书保存在 SDK 的凭证存储中
+// 账号所属学校登记为证书属性, 链码及离线核验时要求签名证书的学校与信息一致
+// 已吊销的账号重新登记时使用新的名称, fabric-ca 不允许复用已吊销的身份
+func (t *IdentitySetup) Enroll(owner, school string) (*Identity, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	enrollID := owner
+	if old, ok := t.identities[owner]; ok {
+		if old.Status == IdentityActive {
+			return nil, fmt.Errorf("账号 %s 已有 Fabric 身份 %s", owner, old.EnrollID)
+		}
+		enrollID = fmt.Sprintf("%s.%d", owner, time.Now().Unix())
+	}
+
+	attrs := []msp.Attribute{{Name: "edu.account", Value: owner, ECert: true}}
+	if school != "" {
+		attrs = append(attrs, msp.Attribute{Name: SchoolAttr, Value: school, ECert: true})
+	}
+	secret, err := t.MSP.Register(&msp.RegistrationRequest{
+		Name: enrollID,
+		Type: "client",
+		Affiliation: t.Affiliation,
+		Attributes: attrs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("在 fabric-ca 中登记身份 %s 失败: %v", enrollID, err)
+	}
+
+	err = t.MSP.Enroll(enrollID, msp.WithSecret(secret))
+	if err != nil {
+		return nil, fmt.Errorf("注册身份 %s 失败: %v", enrollID, err)
+	}
+
+	id := &Identity{Owner: owner, EnrollID: enrollID, School: school, Status: IdentityActive, EnrolledAt: time.Now()}
+	t.identities[owner] = id
+	delete(t.setups, owner)
+
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("已为账号 %s 注册 Fabric 身份 %s\n", owner, enrollID)
+	result := *id
+	return &result, nil
+}
+
+// 吊销账号对应的 Fabric 身份, 并以默认身份将吊销的证书记录到账本中, 之后链码拒绝该账号的写入
+// 通道 MSP 未配置 CRL, Peer 仍接受吊销的证书, 因此由链码根据账本中的记录拒绝
+// 记录到账本失败时可再次吊销, 只重新记录尚未记录的证书
+func (t *IdentitySetup) Revoke(owner, note string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, ok := t.identities[owner]
+	if !ok || (id.Status != IdentityActive && len(id.Unrecorded) == 0) {
+		return fmt.Errorf("账号 %s 没有可吊销的 Fabric 身份", owner)
+	}
+
+	if id.Status == IdentityActive {
+		resp, err := t.MSP.Revoke(&msp.RevocationRequest{Name: id.EnrollID, Reason: revokeReason})
+		if err != nil {
+			return fmt.Errorf("吊销身份 %s 失败: %v", id.EnrollID, err)
+		}
+
+		id.Status = IdentityRevoked
+		id.RevokedAt = time.Now()
+		id.RevokeNote = note
+		id.Unrecorded = resp.RevokedCerts
+		delete(t.setups, owner)
+		if err := t.save(); err != nil {
+			return err
+		}
+		fmt.Printf("已吊销账号 %s 的 Fabric 身份 %s\n", owner, id.EnrollID)
+	}
+
+	for len(id.Unrecorded) > 0 {
+		c := id.Unrecorded[0]
+		if _, err := t.Default.RevokeCert(c.AKI, c.Serial, id.RevokeNote); err != nil {
+			return fmt.Errorf("身份 %s 已在 fabric-ca 中吊销, 但记录到账本失败, 请稍后重试: %v", id.EnrollID, err)
+		}
+		id.Unrecorded = id.Unrecorded[1:]
+		if err := t.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 返回以账号对应身份调用链码的 ServiceSetup
+// 未登记身份的账号使用默认身份, 身份已吊销时返回错误
+func (t *IdentitySetup) SetupFor(owner string) (*ServiceSetup, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, ok := t.identities[owner]
+	if !ok {
+		return t.Default, nil
+	}
+	if id.Status != IdentityActive {
+		return nil, fmt.Errorf("账号 %s 的 Fabric 身份已被吊销", owner)
+	}
+
+	if setup, ok := t.setups[owner]; ok {
+		return setup, nil
+	}
+
+	ctx := t.SDK.ChannelContext(t.ChannelID, fabsdk.WithUser(id.EnrollID), fabsdk.WithOrg(t.OrgName))
+	client, err := channel.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("为身份 %s 创建通道客户端失败: %v", id.EnrollID, err)
+	}
+	signer, err := NewSigner(t.SDK, id.EnrollID, t.OrgName)
+	if err != nil {
+		return nil, err
+	}
+
+	setup := &ServiceSetup{
+		ChaincodeID: t.Default.ChaincodeID,
+		Client: client,
+		Ledger: t.Default.Ledger,
+		Endorsers: t.Default.Endorsers,
+		Owner: owner,
+		Outbox: t.Default.Outbox,
+		SaltKey: t.Default.SaltKey,
+		Signer: signer,
+	}
+	t.setups[owner] = setup
+	return setup, nil
+}
+
+// 返回以所属学校的某个身份调用链码的 ServiceSetup, 供命令行写入指定学校的信息
+// 默认身份没有登记学校, 无法签名信息
+func (t *IdentitySetup) SetupForSchool(school string) (*ServiceSetup, error) {
+	t.mu.Lock()
+	var owners []string
+	for _, id := range t.identities {
+		if id.Status == IdentityActive && school != "" && id.School == school {
+			owners = append(owners, id.Owner)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(owners) == 0 {
+		return nil, fmt.Errorf("学校 %s 没有已注册 Fabric 身份的账号, 请由管理员为本校登记员注册身份", school)
+	}
+	sort.Strings(owners)
+	return t.SetupFor(owners[0])
+}
+
+// 将已在 fabric-ca 吊销的证书记录到账本中, 链码此后拒绝该证书提交的写入
+func (t *ServiceSetup) RevokeCert(aki, serial, reason string) (string, error) {
+	key, err := NewIdempotencyKey()
+	if err != nil {
+		return "", err
+	}
+	return t.submit(key, "revokeCert", [][]byte{[]byte(aki), []byte(serial), []byte(reason)}, nil)
+}
@@ -0,0 +1,328 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 提交任务的状态
+const (
+	JobQueued = "queued"	// 等待提交, 暂时性错误重试前同样处于此状态
+	JobEndorsed = "endorsed"	// 已完成背书, 等待交易提交到账本
+	JobCommitted = "committed"	// 交易已提交到账本
+	JobFailed = "failed"	// 提交失败
+)
+
+// 可通过任务提交的链码函数及其事件名称
+var jobEvents = map[string]string{
+	"addEdu": "eventAddEdu",
+	"updateEdu": "eventModifyEdu",
+	"revokeEdu": "eventRevokeEdu",
+}
+
+// 已结束的任务保留的时长, 超过后在服务重启时清除
+const jobRetention = 7 * 24 * time.Hour
+
+// 添加、修改或撤销学历信息的提交任务
+type Job struct {
+	ID	string
+	Fcn	string	// addEdu、updateEdu 或 revokeEdu
+	Owner	string	// 提交任务的账号, 交易以该账号的身份签名
+	Edu	Education	// 撤销时为被撤销的信息
+	Reason	string	`json:",omitempty"`	// 撤销原因
+	Status	string
+	Attempts	int	// 已尝试提交的次数
+	TxID	string	`json:",omitempty"`
+	Error	string	`json:",omitempty"`	// 失败原因, 重试前为上次失败的原因
+	CreatedAt	time.Time
+	UpdatedAt	time.Time
+}
+
+func (j Job) Finished() bool {
+	return j.Status == JobCommitted || j.Status == JobFailed
+}
+
+// 保存在本地 JSON 文件中的提交任务队列, 由多个 worker 依次调用链码
+// 服务重启后未结束的任务会重新提交
+type JobQueue struct {
+	Path	string
+	SetupFor	func(owner string) (*ServiceSetup, error)	// 返回以账号对应身份调用链码的 ServiceSetup
+	MaxAttempts	int	// 暂时性错误的最大尝试次数
+	RetryDelay	time.Duration	// 首次重试前的等待时间, 此后每次加倍
+
+	mu	sync.Mutex
+	cond	*sync.Cond
+	jobs	map[string]*Job
+	pending	[]string
+}
+
+func OpenJobQueue(path string, setupFor func(owner string) (*ServiceSetup, error)) (*JobQueue, error) {
+	q := &JobQueue{
+		Path: path,
+		SetupFor: setupFor,
+		MaxAttempts: 5,
+		RetryDelay: 2 * time.Second,
+		jobs: make(map[string]*Job),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取任务队列文件失败: %v", err)
+	}
+
+	var list []*Job
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("解析任务队列文件失败: %v", err)
+	}
+	for _, j := range list {
+		if j.Finished() && time.Since(j.UpdatedAt) > jobRetention {
+			continue
+		}
+		q.jobs[j.ID] = j
+	}
+	return q, nil
+}
+
+// 启动 worker, 并重新提交上次退出时未结束的任务
+func (q *JobQueue) Start(workers int) {
+	q.mu.Lock()
+	var unfinished []*Job
+	for _, j := range q.jobs {
+		if !j.Finished() {
+			unfinished = append(unfinished, j)
+		}
+	}
+	sort.Slice(unfinished, func(i, k int) bool { return unfinished[i].CreatedAt.Before(unfinished[k].CreatedAt) })
+	for _, j := range unfinished {
+		// 已背书的任务保持原状态, 重新提交时先经发件箱核对账本
+		if j.Status != JobEndorsed {
+			j.Status = JobQueued
+		}
+		q.pending = append(q.pending, j.ID)
+	}
+	q.mu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+}
+
+// 将添加(addEdu)或修改(updateEdu)学历信息的请求加入队列
+func (q *JobQueue) Submit(owner, fcn string, edu Education) (Job, error) {
+	if fcn != "addEdu" && fcn != "updateEdu" {
+		return Job{}, fmt.Errorf("不支持的链码函数: %s", fcn)
+	}
+	return q.add(&Job{Fcn: fcn, Owner: owner, Edu: edu})
+}
+
+// 将撤销学历信息的请求加入队列, 撤销原因不能为空
+func (q *JobQueue) Revoke(owner string, edu Education, reason string) (Job, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return Job{}, fmt.Errorf("撤销原因不能为空")
+	}
+	return q.add(&Job{Fcn: "revokeEdu", Owner: owner, Edu: edu, Reason: reason})
+}
+
+func (q *JobQueue) add(job *Job) (Job, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now()
+	job.ID = id
+	job.Status = JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.jobs[id] = job
+	if err := q.save(); err != nil {
+		delete(q.jobs, id)
+		return Job{}, err
+	}
+	q.enqueue(id)
+	return *job, nil
+}
+
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// 返回账号提交的任务, 最近提交的在前
+func (q *JobQueue) List(owner string) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var list []Job
+	for _, j := range q.jobs {
+		if j.Owner == owner {
+			list = append(list, *j)
+		}
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.After(list[k].CreatedAt) })
+	return list
+}
+
+// 调用方需持有锁
+func (q *JobQueue) enqueue(id string) {
+	q.pending = append(q.pending, id)
+	q.cond.Signal()
+}
+
+func (q *JobQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 {
+			q.cond.Wait()
+		}
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+		job := *q.jobs[id]
+		q.mu.Unlock()
+
+		q.process(job)
+	}
+}
+
+// 提交任务对应的交易, 暂时性错误在等待后重新加入队列
+func (q *JobQueue) process(job Job) {
+	setup, err := q.SetupFor(job.Owner)
+	if err != nil {
+		q.update(job.ID, func(j *Job) {
+			j.Status = JobFailed
+			j.Error = err.Error()
+		})
+		return
+	}
+
+	args, err := job.args()
+	if err != nil {
+		q.update(job.ID, func(j *Job) {
+			j.Status = JobFailed
+			j.Error = err.Error()
+		})
+		return
+	}
+
+	q.update(job.ID, func(j *Job) { j.Attempts++ })
+
+	// 以任务编号作为幂等键, 服务重启后重新提交的任务不会重复写入账本
+	txID, err := setup.submit(job.ID, job.Fcn, args, func(txID string) {
+		q.update(job.ID, func(j *Job) {
+			j.Status = JobEndorsed
+			j.TxID = txID
+		})
+	})
+	if err == nil {
+		q.update(job.ID, func(j *Job) {
+			j.Status = JobCommitted
+			j.TxID = txID
+			j.Error = ""
+		})
+		return
+	}
+
+	var retry time.Duration
+	q.update(job.ID, func(j *Job) {
+		j.Error = ErrorMessage(err)
+		// 已背书的交易等待提交超时时仍可能写入账本, 保持已背书状态, 等待后经发件箱核对账本,
+		// 未写入时才重新提交; 达到最大尝试次数后记录最后的交易编号并标记为失败
+		if isTimeout(err) && txID != "" && setup.Outbox != nil {
+			j.TxID = txID
+			if j.Attempts < q.MaxAttempts {
+				j.Status = JobEndorsed
+				retry = q.RetryDelay << uint(j.Attempts-1)
+				return
+			}
+		}
+		if (IsTransient(err) || err == ErrInFlight) && j.Attempts < q.MaxAttempts {
+			j.Status = JobQueued
+			retry = q.RetryDelay << uint(j.Attempts-1)
+			return
+		}
+		j.Status = JobFailed
+	})
+	if retry > 0 {
+		log.Printf("任务 %s 提交未完成, %v 后重试: %v", job.ID, retry, err)
+		time.AfterFunc(retry, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.enqueue(job.ID)
+		})
+	}
+}
+
+// 任务对应的链码参数
+func (j Job) args() ([][]byte, error) {
+	if j.Fcn == "revokeEdu" {
+		return [][]byte{[]byte(j.Edu.EntityID), []byte(j.Reason), []byte(jobEvents[j.Fcn])}, nil
+	}
+
+	b, err := json.Marshal(j.Edu)
+	if err != nil {
+		return nil, fmt.Errorf("指定的edu对象序列化时发生错误: %v", err)
+	}
+	return [][]byte{b, []byte(jobEvents[j.Fcn])}, nil
+}
+
+// 修改任务状态并写回文件
+func (q *JobQueue) update(id string, change func(j *Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j := q.jobs[id]
+	change(j)
+	j.UpdatedAt = time.Now()
+	if err := q.save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// 将任务写入文件, 调用方需持有锁
+func (q *JobQueue) save() error {
+	list := make([]*Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.Before(list[k].CreatedAt) })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := q.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存任务队列文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, q.Path); err != nil {
+		return fmt.Errorf("保存任务队列文件失败: %v", err)
+	}
+	return nil
+}
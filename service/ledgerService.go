@@ -0,0 +1,303 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+	"time"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mspproto "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+)
+
+// 交易的区块及背书等元数据
+type TxInfo struct {
+	TxID           string
+	ChannelID      string
+	BlockNumber    uint64
+	Timestamp      time.Time
+	ValidationCode string // 交易验证码, VALID 表示交易有效
+	Valid          bool
+	Creator        string   // 交易提交者
+	Endorsers      []string // 背书节点
+
+	ChaincodeID    string
+	Function       string
+	Args           []string
+	ResponseStatus int32
+	ResponseMsg    string
+	EventName      string
+}
+
+// 链的基本信息
+type ChainInfo struct {
+	Height            uint64
+	CurrentBlockHash  string
+	PreviousBlockHash string
+	Endorser          string // 应答的节点
+}
+
+// 区块的概要信息及其包含的交易
+type BlockInfo struct {
+	Number       uint64
+	DataHash     string
+	PreviousHash string
+	Timestamp    time.Time // 区块中首个交易的时间
+	TxCount      int
+	Txs          []*TxInfo
+}
+
+// 查询当前通道的区块高度等信息
+func (t *ServiceSetup) QueryChainInfo() (*ChainInfo, error) {
+	if t.Ledger == nil {
+		return nil, fmt.Errorf("账本客户端未初始化")
+	}
+
+	resp, err := t.Ledger.QueryInfo()
+	if err != nil {
+		return nil, fmt.Errorf("查询链信息失败: %v", err)
+	}
+
+	return &ChainInfo{
+		Height:            resp.BCI.Height,
+		CurrentBlockHash:  fmt.Sprintf("%x", resp.BCI.CurrentBlockHash),
+		PreviousBlockHash: fmt.Sprintf("%x", resp.BCI.PreviousBlockHash),
+		Endorser:          resp.Endorser,
+	}, nil
+}
+
+// 根据交易编号查询交易详情(所在区块、提交时间、验证结果及背书节点)
+func (t *ServiceSetup) FindTxInfo(txID string) (*TxInfo, error) {
+	if t.Ledger == nil {
+		return nil, fmt.Errorf("账本客户端未初始化")
+	}
+
+	processed, err := t.Ledger.QueryTransaction(fab.TransactionID(txID))
+	if err != nil {
+		return nil, fmt.Errorf("根据交易编号查询交易失败: %v", err)
+	}
+
+	info, err := parseEnvelope(processed.TransactionEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	info.ValidationCode = pb.TxValidationCode(processed.ValidationCode).String()
+	info.Valid = processed.ValidationCode == int32(pb.TxValidationCode_VALID)
+
+	block, err := t.Ledger.QueryBlockByTxID(fab.TransactionID(txID))
+	if err != nil {
+		return nil, fmt.Errorf("根据交易编号查询区块失败: %v", err)
+	}
+	info.BlockNumber = block.Header.Number
+
+	return info, nil
+}
+
+// 根据交易编号查询交易详情, 交易参数中的个人信息已脱敏, 用于区块浏览
+func (t *ServiceSetup) FindMaskedTxInfo(txID string) (*TxInfo, error) {
+	info, err := t.FindTxInfo(txID)
+	if err != nil {
+		return nil, err
+	}
+	MaskTxArgs(info)
+	return info, nil
+}
+
+// 根据区块号查询区块及其中的交易, 交易参数中的个人信息已脱敏
+func (t *ServiceSetup) FindBlock(number uint64) (*BlockInfo, error) {
+	if t.Ledger == nil {
+		return nil, fmt.Errorf("账本客户端未初始化")
+	}
+
+	block, err := t.Ledger.QueryBlock(number)
+	if err != nil {
+		return nil, fmt.Errorf("根据区块号查询区块失败: %v", err)
+	}
+
+	return parseBlock(block), nil
+}
+
+// 查询最新的 n 个区块, 按区块号倒序排列
+func (t *ServiceSetup) FindLatestBlocks(n int) ([]*BlockInfo, error) {
+	chain, err := t.QueryChainInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*BlockInfo
+	for num := int64(chain.Height) - 1; num >= 0 && len(blocks) < n; num-- {
+		block, err := t.FindBlock(uint64(num))
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// 为edu的历史记录补充交易的区块号、时间戳及验证结果
+func (t *ServiceSetup) EnrichHistory(edu *Education) {
+	for i := range edu.Historys {
+		info, err := t.FindTxInfo(edu.Historys[i].TxId)
+		if err != nil {
+			fmt.Printf("查询历史记录对应的交易信息失败: %v\n", err)
+			continue
+		}
+		edu.Historys[i].TxInfo = info
+	}
+}
+
+// 解析区块, 交易的验证结果取自区块元数据中的交易过滤器
+func parseBlock(block *common.Block) *BlockInfo {
+	info := &BlockInfo{
+		Number:       block.Header.Number,
+		DataHash:     fmt.Sprintf("%x", block.Header.DataHash),
+		PreviousHash: fmt.Sprintf("%x", block.Header.PreviousHash),
+	}
+	if block.Data == nil {
+		return info
+	}
+
+	var txFilter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	for i, data := range block.Data.Data {
+		env, err := utils.GetEnvelopeFromBlock(data)
+		if err != nil {
+			fmt.Printf("解析区块 %d 中的第 %d 个交易失败: %v\n", block.Header.Number, i, err)
+			continue
+		}
+		tx, err := parseEnvelope(env)
+		if err != nil {
+			fmt.Printf("解析区块 %d 中的第 %d 个交易失败: %v\n", block.Header.Number, i, err)
+			continue
+		}
+
+		tx.BlockNumber = block.Header.Number
+		if i < len(txFilter) {
+			tx.ValidationCode = pb.TxValidationCode(txFilter[i]).String()
+			tx.Valid = txFilter[i] == byte(pb.TxValidationCode_VALID)
+		}
+		MaskTxArgs(tx)
+
+		if info.Timestamp.IsZero() {
+			info.Timestamp = tx.Timestamp
+		}
+		info.Txs = append(info.Txs, tx)
+	}
+	info.TxCount = len(block.Data.Data)
+
+	return info
+}
+
+// 解析交易信封
+func parseEnvelope(env *common.Envelope) (*TxInfo, error) {
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return nil, fmt.Errorf("解析交易内容失败: %v", err)
+	}
+
+	chdr, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, fmt.Errorf("解析通道头失败: %v", err)
+	}
+
+	info := &TxInfo{
+		TxID:      chdr.TxId,
+		ChannelID: chdr.ChannelId,
+	}
+	if ts := chdr.Timestamp; ts != nil {
+		info.Timestamp = time.Unix(ts.Seconds, int64(ts.Nanos))
+	}
+
+	shdr, err := utils.GetSignatureHeader(payload.Header.SignatureHeader)
+	if err == nil {
+		info.Creator = identityName(shdr.Creator)
+	}
+
+	if chdr.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		info.Function = common.HeaderType(chdr.Type).String()
+		return info, nil
+	}
+
+	tx, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("解析交易失败: %v", err)
+	}
+	if len(tx.Actions) == 0 {
+		return info, nil
+	}
+
+	cap, err := utils.GetChaincodeActionPayload(tx.Actions[0].Payload)
+	if err != nil {
+		return nil, fmt.Errorf("解析链码调用内容失败: %v", err)
+	}
+
+	for _, e := range cap.Action.Endorsements {
+		info.Endorsers = append(info.Endorsers, identityName(e.Endorser))
+	}
+
+	cpp, err := utils.GetChaincodeProposalPayload(cap.ChaincodeProposalPayload)
+	if err == nil {
+		cis := &pb.ChaincodeInvocationSpec{}
+		if err := proto.Unmarshal(cpp.Input, cis); err == nil && cis.ChaincodeSpec != nil {
+			if cis.ChaincodeSpec.ChaincodeId != nil {
+				info.ChaincodeID = cis.ChaincodeSpec.ChaincodeId.Name
+			}
+			if cis.ChaincodeSpec.Input != nil {
+				for i, arg := range cis.ChaincodeSpec.Input.Args {
+					if i == 0 {
+						info.Function = string(arg)
+						continue
+					}
+					info.Args = append(info.Args, string(arg))
+				}
+			}
+		}
+	}
+
+	prp, err := utils.GetProposalResponsePayload(cap.Action.ProposalResponsePayload)
+	if err == nil {
+		ca, err := utils.GetChaincodeAction(prp.Extension)
+		if err == nil {
+			if ca.Response != nil {
+				info.ResponseStatus = ca.Response.Status
+				info.ResponseMsg = ca.Response.Message
+			}
+			if ev, err := utils.GetChaincodeEvents(ca.Events); err == nil {
+				info.EventName = ev.EventName
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// 将序列化的身份转换为 "CN(MSPID)" 形式的可读名称
+func identityName(serialized []byte) string {
+	sid := &mspproto.SerializedIdentity{}
+	if err := proto.Unmarshal(serialized, sid); err != nil {
+		return ""
+	}
+
+	block, _ := pem.Decode(sid.IdBytes)
+	if block == nil {
+		return sid.Mspid
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return sid.Mspid
+	}
+	return cert.Subject.CommonName + "(" + sid.Mspid + ")"
+}
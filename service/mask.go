@@ -0,0 +1,65 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// 交易参数中需要脱敏的个人信息字段, 及派生各字段盐值的随机数
+var piiFields = []string{"Name", "EntityID", "BirthDay", "Place", "Photo", "SaltNonce"}
+
+// 对交易参数中的个人信息进行脱敏, 用于区块浏览等不需要展示明文的场景
+func MaskTxArgs(tx *TxInfo) {
+	for i, arg := range tx.Args {
+		tx.Args[i] = maskArg(tx.Function, i, arg)
+	}
+}
+
+func maskArg(fcn string, index int, arg string) string {
+	// Education 对象以 JSON 形式作为参数提交
+	var obj map[string]interface{}
+	if strings.HasPrefix(arg, "{") && json.Unmarshal([]byte(arg), &obj) == nil {
+		for _, field := range piiFields {
+			if v, ok := obj[field].(string); ok {
+				obj[field] = MaskString(v)
+			}
+		}
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return MaskString(arg)
+		}
+		return string(b)
+	}
+
+	switch fcn {
+	case "queryEduInfoByEntityID", "delEdu", "revokeEdu":
+		// 第一个参数为身份证号
+		if index == 0 {
+			return MaskString(arg)
+		}
+	case "queryEduByCertNoAndName":
+		// 第二个参数为姓名
+		if index == 1 {
+			return MaskString(arg)
+		}
+	}
+
+	return arg
+}
+
+// 保留首尾字符, 其余以 * 代替
+func MaskString(s string) string {
+	r := []rune(s)
+	switch {
+	case len(r) == 0:
+		return s
+	case len(r) <= 2:
+		return string(r[0]) + strings.Repeat("*", len(r)-1)
+	default:
+		return string(r[0]) + strings.Repeat("*", len(r)-2) + string(r[len(r)-1])
+	}
+}
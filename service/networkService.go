@@ -0,0 +1,155 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/common/ccprovider"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+)
+
+// 网络管理: 保留启动时创建的资源管理客户端, 用于查询通道及链码状态
+type NetworkSetup struct {
+	ChannelID	string
+	ChaincodeID	string
+	OrgName	string
+	ConfiguredPolicy	string	// 配置文件中指定的背书策略
+	Peers	[]string	// 本组织的 Peer 节点名称
+	ResMgmt	*resmgmt.Client
+	Client	*channel.Client	// 用于查询系统链码 lscc
+}
+
+type ChaincodeInfo struct {
+	Name	string
+	Version	string
+	Path	string
+}
+
+// Peer 节点的状态
+type PeerStatus struct {
+	Name	string
+	Reachable	bool
+	Latency	time.Duration
+	Error	string
+	Channels	[]string	// 已加入的通道
+	Joined	bool	// 是否已加入应用通道
+	Installed	[]ChaincodeInfo	// 已安装的链码
+	Instantiated	[]ChaincodeInfo	// 在应用通道上已实例化的链码
+}
+
+type NetworkInfo struct {
+	ChannelID	string
+	ChaincodeID	string
+	OrgName	string
+	Policy	string	// 应用链码当前的背书策略
+	ConfiguredPolicy	string	// 配置文件中指定的背书策略, 与当前策略不一致时需升级链码
+	Peers	[]PeerStatus
+}
+
+// 查询各 Peer 节点已加入的通道、已安装及已实例化的链码, 以及应用链码的背书策略
+func (t *NetworkSetup) QueryNetwork() (*NetworkInfo, error) {
+	if t.ResMgmt == nil {
+		return nil, fmt.Errorf("资源管理客户端未初始化")
+	}
+
+	info := &NetworkInfo{
+		ChannelID: t.ChannelID,
+		ChaincodeID: t.ChaincodeID,
+		OrgName: t.OrgName,
+		ConfiguredPolicy: t.ConfiguredPolicy,
+	}
+
+	for _, peer := range t.Peers {
+		info.Peers = append(info.Peers, t.queryPeer(peer))
+	}
+
+	policy, err := t.QueryPolicy()
+	if err != nil {
+		info.Policy = err.Error()
+	} else {
+		info.Policy = policy
+	}
+
+	return info, nil
+}
+
+// 查询单个 Peer 节点的状态, 节点不可达时记录错误信息
+func (t *NetworkSetup) queryPeer(peer string) PeerStatus {
+	status := PeerStatus{Name: peer}
+	target := resmgmt.WithTargetEndpoints(peer)
+
+	start := time.Now()
+	channels, err := t.ResMgmt.QueryChannels(target)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Reachable = true
+	status.Latency = time.Since(start)
+
+	for _, ch := range channels.Channels {
+		status.Channels = append(status.Channels, ch.ChannelId)
+		if ch.ChannelId == t.ChannelID {
+			status.Joined = true
+		}
+	}
+
+	installed, err := t.ResMgmt.QueryInstalledChaincodes(target)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Installed = chaincodeInfos(installed)
+
+	if status.Joined {
+		instantiated, err := t.ResMgmt.QueryInstantiatedChaincodes(t.ChannelID, target)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		status.Instantiated = chaincodeInfos(instantiated)
+	}
+
+	return status
+}
+
+// 通过系统链码 lscc 查询应用链码实例化时指定的背书策略
+func (t *NetworkSetup) QueryPolicy() (string, error) {
+	if t.Client == nil {
+		return "", fmt.Errorf("通道客户端未初始化")
+	}
+
+	req := channel.Request{ChaincodeID: "lscc", Fcn: "getccdata", Args: [][]byte{[]byte(t.ChannelID), []byte(t.ChaincodeID)}}
+	respone, err := t.Client.Query(req)
+	if err != nil {
+		return "", fmt.Errorf("查询链码背书策略失败: %v", err)
+	}
+
+	ccData := &ccprovider.ChaincodeData{}
+	if err := proto.Unmarshal(respone.Payload, ccData); err != nil {
+		return "", fmt.Errorf("解析链码数据失败: %v", err)
+	}
+
+	env := &common.SignaturePolicyEnvelope{}
+	if err := proto.Unmarshal(ccData.Policy, env); err != nil {
+		return "", fmt.Errorf("解析背书策略失败: %v", err)
+	}
+
+	return PolicyString(env), nil
+}
+
+func chaincodeInfos(resp *pb.ChaincodeQueryResponse) []ChaincodeInfo {
+	var infos []ChaincodeInfo
+	for _, cc := range resp.Chaincodes {
+		infos = append(infos, ChaincodeInfo{Name: cc.Name, Version: cc.Version, Path: cc.Path})
+	}
+	return infos
+}
@@ -0,0 +1,419 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+)
+
+// 发件箱中调用记录的状态
+const (
+	OutboxPending = "pending"	// 已记录, 尚未完成背书; 服务异常退出时交易可能未发出
+	OutboxEndorsed = "endorsed"	// 已背书并确定交易编号, 交易可能已发送至排序服务
+	OutboxCommitted = "committed"	// 交易已写入账本
+	OutboxFailed = "failed"	// 交易失败, 可使用相同的幂等键重新提交
+)
+
+// 已结束的记录保留的时长, 在此期间使用相同幂等键的请求不会重复写入账本
+const outboxRetention = 7 * 24 * time.Hour
+
+var (
+	ErrInFlight = errors.New("相同幂等键的请求正在处理中")
+	ErrKeyReused = errors.New("幂等键已用于其他请求")
+)
+
+// 一次链码调用, 在发送交易前写入发件箱
+type OutboxEntry struct {
+	Key	string	// 幂等键
+	Owner	string	// 签名交易的 Web 账号, 为空时为默认身份
+	Fcn	string
+	Args	[]string
+	State	string
+	TxID	string	`json:",omitempty"`
+	Error	string	`json:",omitempty"`
+	Attempts	int
+	CreatedAt	time.Time
+	UpdatedAt	time.Time
+}
+
+// 链码调用的预写日志: 每次状态变化以一行 JSON 追加到文件并同步到磁盘,
+// 服务重启后根据账本核对未确认的调用, 未写入账本的重新提交, 使每个幂等键只写入一次
+type Outbox struct {
+	Path	string
+
+	mu	sync.Mutex
+	file	*os.File
+	entries	map[string]*OutboxEntry
+	inflight	map[string]bool
+}
+
+// 读取发件箱文件, 以每个幂等键的最新记录重写文件后继续追加
+func OpenOutbox(path string) (*Outbox, error) {
+	o := &Outbox{Path: path, entries: make(map[string]*OutboxEntry), inflight: make(map[string]bool)}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取发件箱文件失败: %v", err)
+	}
+	if err == nil {
+		err = o.load(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *Outbox) load(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 最后一行没有换行符说明写入时服务异常退出, 该记录未生效
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取发件箱文件失败: %v", err)
+		}
+
+		e := &OutboxEntry{}
+		if err := json.Unmarshal(b, e); err != nil {
+			return fmt.Errorf("解析发件箱文件第 %d 行失败: %v", line, err)
+		}
+		o.entries[e.Key] = e
+	}
+}
+
+// 清除过期的记录并重写文件
+func (o *Outbox) compact() error {
+	var list []*OutboxEntry
+	for key, e := range o.entries {
+		finished := e.State == OutboxCommitted || e.State == OutboxFailed
+		if finished && time.Since(e.UpdatedAt) > outboxRetention {
+			delete(o.entries, key)
+			continue
+		}
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.Before(list[j].UpdatedAt) })
+
+	tmp := o.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("保存发件箱文件失败: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range list {
+		b, _ := json.Marshal(e)
+		w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("保存发件箱文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, o.Path); err != nil {
+		return fmt.Errorf("保存发件箱文件失败: %v", err)
+	}
+
+	o.file, err = os.OpenFile(o.Path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("打开发件箱文件失败: %v", err)
+	}
+	return nil
+}
+
+func (o *Outbox) Get(key string) (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, ok := o.entries[key]
+	if !ok {
+		return OutboxEntry{}, false
+	}
+	return *e, true
+}
+
+// 尚未确认结果的调用
+func (o *Outbox) Unconfirmed() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var list []OutboxEntry
+	for _, e := range o.entries {
+		if e.State == OutboxPending || e.State == OutboxEndorsed {
+			list = append(list, *e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// 开始处理幂等键对应的调用, 返回已有的记录, 新的幂等键返回 State 为空的记录
+func (o *Outbox) begin(key, owner, fcn string, args []string) (OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.inflight[key] {
+		return OutboxEntry{}, ErrInFlight
+	}
+
+	e, ok := o.entries[key]
+	if !ok {
+		now := time.Now()
+		e = &OutboxEntry{Key: key, Owner: owner, Fcn: fcn, Args: args, CreatedAt: now, UpdatedAt: now}
+	} else if e.Fcn != fcn || !reflect.DeepEqual(e.Args, args) {
+		return OutboxEntry{}, ErrKeyReused
+	}
+
+	o.inflight[key] = true
+	return *e, nil
+}
+
+func (o *Outbox) end(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inflight, key)
+}
+
+// 修改记录并追加到文件, 写入磁盘后才返回
+func (o *Outbox) record(entry OutboxEntry, change func(e *OutboxEntry)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, ok := o.entries[entry.Key]
+	if !ok {
+		e = &entry
+	}
+	updated := *e
+	change(&updated)
+	updated.UpdatedAt = time.Now()
+
+	b, err := json.Marshal(&updated)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("写入发件箱失败: %v", err)
+	}
+	if err := o.file.Sync(); err != nil {
+		return fmt.Errorf("写入发件箱失败: %v", err)
+	}
+
+	o.entries[updated.Key] = &updated
+	return nil
+}
+
+// 核对未确认的调用, 未写入账本的以原有身份重新提交
+// setupFor 返回以账号对应身份调用链码的 ServiceSetup
+func (o *Outbox) Reconcile(setupFor func(owner string) (*ServiceSetup, error)) {
+	for _, e := range o.Unconfirmed() {
+		setup, err := setupFor(e.Owner)
+		if err == nil {
+			_, err = setup.submit(e.Key, e.Fcn, toBytes(e.Args), nil)
+		}
+		if err != nil {
+			fmt.Printf("重新提交发件箱中的调用 %s(%s) 失败: %v\n", e.Fcn, e.Key, err)
+			continue
+		}
+		fmt.Printf("发件箱中的调用 %s(%s) 已确认\n", e.Fcn, e.Key)
+	}
+}
+
+// 以幂等键 key 调用链码: 发送交易前记录调用, 相同的键只会写入账本一次,
+// 重复调用时返回首次写入的交易编号; 未配置发件箱时直接调用链码
+func (t *ServiceSetup) submit(key, fcn string, args [][]byte, endorsed func(txID string)) (string, error) {
+	args, transient, err := t.withSalts(key, fcn, args)
+	if err != nil {
+		return "", err
+	}
+	args, err = t.withSignature(key, fcn, args)
+	if err != nil {
+		return "", err
+	}
+
+	o := t.Outbox
+	if o == nil {
+		return t.invoke(fcn, args, transient, endorsed)
+	}
+
+	entry, err := o.begin(key, t.Owner, fcn, toStrings(args))
+	if err != nil {
+		return "", err
+	}
+	defer o.end(key)
+
+	switch entry.State {
+	case OutboxCommitted:
+		return entry.TxID, nil
+
+	case OutboxPending, OutboxEndorsed:
+		// 上次提交的结果未知, 先核对账本, 避免重复写入
+		txID, committed, err := t.confirm(entry)
+		if err != nil {
+			return "", fmt.Errorf("核对账本失败: %v", err)
+		}
+		if committed {
+			err = o.record(entry, func(e *OutboxEntry) {
+				e.State = OutboxCommitted
+				e.TxID = txID
+				e.Error = ""
+			})
+			return txID, err
+		}
+	}
+
+	err = o.record(entry, func(e *OutboxEntry) {
+		e.State = OutboxPending
+		e.TxID = ""
+		e.Error = ""
+		e.Attempts++
+	})
+	if err != nil {
+		return "", err
+	}
+
+	txID, err := t.invoke(fcn, args, transient, func(txID string) {
+		err := o.record(entry, func(e *OutboxEntry) {
+			e.State = OutboxEndorsed
+			e.TxID = txID
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+		if endorsed != nil {
+			endorsed(txID)
+		}
+	})
+	if err != nil {
+		// 已背书的交易等待提交超时时仍可能写入账本, 保留记录待核对
+		if current, _ := o.Get(key); isTimeout(err) && current.State == OutboxEndorsed {
+			return current.TxID, err
+		}
+		if err := o.record(entry, func(e *OutboxEntry) {
+			e.State = OutboxFailed
+			e.Error = ErrorMessage(err)
+		}); err != nil {
+			fmt.Println(err)
+		}
+		return txID, err
+	}
+
+	return txID, o.record(entry, func(e *OutboxEntry) {
+		e.State = OutboxCommitted
+		e.TxID = txID
+	})
+}
+
+// 根据交易编号或账本中的数据判断调用是否已写入账本
+func (t *ServiceSetup) confirm(entry OutboxEntry) (string, bool, error) {
+	if entry.TxID != "" {
+		info, err := t.FindTxInfo(entry.TxID)
+		if err == nil {
+			return entry.TxID, info.Valid, nil
+		}
+	}
+
+	if len(entry.Args) == 0 {
+		return "", false, nil
+	}
+
+	switch entry.Fcn {
+	case "addEdu", "updateEdu":
+		var want Education
+		if err := json.Unmarshal([]byte(entry.Args[0]), &want); err != nil {
+			return "", false, err
+		}
+		result, err := t.FindEduInfoByEntityID(want.EntityID)
+		if IsNotFound(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		var got Education
+		if err := json.Unmarshal(result, &got); err != nil {
+			return "", false, err
+		}
+
+		// 账本中的最新记录与提交的信息一致时视为已写入, 交易编号取最近一次修改
+		// 承诺由链码生成, 不参与比较
+		txID := entry.TxID
+		if n := len(got.Historys); n > 0 {
+			txID = got.Historys[n-1].TxId
+		}
+		want.ObjectType, got.ObjectType = "", ""
+		want.Historys, got.Historys = nil, nil
+		want.Commitments, got.Commitments = nil, nil
+		want.CommitRoot, got.CommitRoot = "", ""
+		return txID, reflect.DeepEqual(want, got), nil
+
+	case "revokeEdu":
+		result, err := t.FindEduInfoByEntityID(entry.Args[0])
+		if err != nil {
+			return "", false, err
+		}
+		var got Education
+		if err := json.Unmarshal(result, &got); err != nil {
+			return "", false, err
+		}
+		txID := entry.TxID
+		if n := len(got.Historys); n > 0 {
+			txID = got.Historys[n-1].TxId
+		}
+		return txID, got.Revoked, nil
+
+	case "delEdu":
+		// 信息不存在不能说明是本次调用删除的(可能从未存在或已被其他交易删除),
+		// 只以上面按交易编号查询的结果为准, 否则视为未写入, 由调用方重新提交
+		return "", false, nil
+	}
+	return "", false, nil
+}
+
+func isTimeout(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && err != nil && s.Group == status.ClientStatus && s.Code == status.Timeout.ToInt32()
+}
+
+// 生成新的幂等键
+func NewIdempotencyKey() (string, error) {
+	return randomHex(16)
+}
+
+func toStrings(args [][]byte) []string {
+	list := make([]string, len(args))
+	for i, arg := range args {
+		list[i] = string(arg)
+	}
+	return list
+}
+
+func toBytes(args []string) [][]byte {
+	list := make([][]byte, len(args))
+	for i, arg := range args {
+		list[i] = []byte(arg)
+	}
+	return list
+}
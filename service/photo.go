@@ -0,0 +1,270 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	ErrPhotoTooLarge = errors.New("照片文件过大")
+	ErrPhotoType = errors.New("照片只支持 JPEG、PNG 或 GIF 格式")
+)
+
+// 各格式照片的扩展名
+var photoExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png": ".png",
+	"image/gif": ".gif",
+}
+
+// 处理后的照片: 重新编码后的原图及标准尺寸的证件照缩略图(JPEG)
+type Photo struct {
+	ContentType	string
+	Ext	string	// 原图的扩展名, 如 .jpg
+	Width	int
+	Height	int
+	Data	[]byte
+	Thumb	[]byte
+}
+
+// 照片处理: 校验大小、格式及尺寸后重新编码, 去除 EXIF 等元数据及图像数据之外附带的内容
+type PhotoProcessor struct {
+	MaxSize	int64	// 文件大小上限(字节)
+	MaxWidth	int
+	MaxHeight	int
+	ThumbWidth	int	// 缩略图尺寸, 按此宽高比从中心裁剪后缩放
+	ThumbHeight	int
+	JPEGQuality	int
+}
+
+func NewPhotoProcessor() *PhotoProcessor {
+	return &PhotoProcessor{
+		MaxSize: 5 << 20,
+		MaxWidth: 4096,
+		MaxHeight: 4096,
+		ThumbWidth: 120,
+		ThumbHeight: 160,
+		JPEGQuality: 90,
+	}
+}
+
+// 读取并处理照片, 超过 MaxSize 时返回 ErrPhotoTooLarge
+func (p *PhotoProcessor) Process(r io.Reader) (*Photo, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, p.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取照片失败: %v", err)
+	}
+	if int64(len(b)) > p.MaxSize {
+		return nil, ErrPhotoTooLarge
+	}
+
+	contentType := http.DetectContentType(b)
+	ext, ok := photoExts[contentType]
+	if !ok {
+		return nil, ErrPhotoType
+	}
+
+	// 解码前先检查尺寸, 避免解码尺寸异常大的图片耗尽内存
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("无法识别的图片: %v", err)
+	}
+	if cfg.Width > p.MaxWidth || cfg.Height > p.MaxHeight {
+		return nil, fmt.Errorf("照片尺寸 %dx%d 超过上限 %dx%d", cfg.Width, cfg.Height, p.MaxWidth, p.MaxHeight)
+	}
+
+	// GIF 只保留第一帧
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("照片解码失败: %v", err)
+	}
+	if contentType == "image/jpeg" {
+		// 重新编码会去除 EXIF, 因此先按其中的方向信息旋转
+		img = orient(img, jpegOrientation(b))
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < p.ThumbWidth || bounds.Dy() < p.ThumbHeight {
+		return nil, fmt.Errorf("照片尺寸 %dx%d 小于证件照尺寸 %dx%d", bounds.Dx(), bounds.Dy(), p.ThumbWidth, p.ThumbHeight)
+	}
+
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.JPEGQuality})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("照片编码失败: %v", err)
+	}
+
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, p.thumbnail(img), &jpeg.Options{Quality: p.JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("生成缩略图失败: %v", err)
+	}
+
+	return &Photo{
+		ContentType: contentType,
+		Ext: ext,
+		Width: bounds.Dx(),
+		Height: bounds.Dy(),
+		Data: buf.Bytes(),
+		Thumb: thumb.Bytes(),
+	}, nil
+}
+
+// 按缩略图的宽高比从中心裁剪, 再以区域平均缩放; 透明部分以白色填充
+func (p *PhotoProcessor) thumbnail(img image.Image) image.Image {
+	src := img.Bounds()
+	crop := src
+	if src.Dx()*p.ThumbHeight > src.Dy()*p.ThumbWidth {
+		w := src.Dy() * p.ThumbWidth / p.ThumbHeight
+		crop.Min.X += (src.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := src.Dx() * p.ThumbHeight / p.ThumbWidth
+		crop.Min.Y += (src.Dy() - h) / 2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.ZP, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, crop.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, p.ThumbWidth, p.ThumbHeight))
+	for y := 0; y < p.ThumbHeight; y++ {
+		y0, y1 := y*crop.Dy()/p.ThumbHeight, (y+1)*crop.Dy()/p.ThumbHeight
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < p.ThumbWidth; x++ {
+			x0, x1 := x*crop.Dx()/p.ThumbWidth, (x+1)*crop.Dx()/p.ThumbWidth
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := rgba.PixOffset(sx, sy)
+					r += uint32(rgba.Pix[i])
+					g += uint32(rgba.Pix[i+1])
+					b += uint32(rgba.Pix[i+2])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff})
+		}
+	}
+	return dst
+}
+
+// 读取 JPEG 中 EXIF 的方向(Orientation)标记, 不存在或无法解析时返回 1
+func jpegOrientation(b []byte) int {
+	// 依次查找 APP1 段, 跳过其他段直至图像数据开始(SOS)
+	for i := 2; i+4 <= len(b) && b[i] == 0xff; {
+		marker := b[i+1]
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if marker == 0xda || size < 2 || i+2+size > len(b) {
+			break
+		}
+		seg := b[i+4 : i+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(t[4:]))
+	if ifd+2 > len(t) {
+		return 1
+	}
+	count := int(order.Uint16(t[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(t) {
+			break
+		}
+		if order.Uint16(t[entry:]) == 0x0112 {
+			o := int(order.Uint16(t[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// 按 EXIF 方向标记将图像转正
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 {
+		return img
+	}
+
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(src.Min.X+x, src.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,58 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mspproto "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+)
+
+// 将签名策略转换为 AND('Org1MSP.peer', ...) 形式的表达式
+func PolicyString(env *common.SignaturePolicyEnvelope) string {
+	if env == nil || env.Rule == nil {
+		return ""
+	}
+	return ruleString(env.Rule, env.Identities)
+}
+
+func ruleString(rule *common.SignaturePolicy, identities []*mspproto.MSPPrincipal) string {
+	if nOutOf := rule.GetNOutOf(); nOutOf != nil {
+		var subs []string
+		for _, r := range nOutOf.Rules {
+			subs = append(subs, ruleString(r, identities))
+		}
+
+		switch {
+		case int(nOutOf.N) == len(nOutOf.Rules):
+			return "AND(" + strings.Join(subs, ", ") + ")"
+		case nOutOf.N == 1:
+			return "OR(" + strings.Join(subs, ", ") + ")"
+		default:
+			return fmt.Sprintf("OutOf(%d, %s)", nOutOf.N, strings.Join(subs, ", "))
+		}
+	}
+
+	index := rule.GetSignedBy()
+	if index < 0 || int(index) >= len(identities) {
+		return "?"
+	}
+	return "'" + principalString(identities[index]) + "'"
+}
+
+func principalString(principal *mspproto.MSPPrincipal) string {
+	if principal.PrincipalClassification != mspproto.MSPPrincipal_ROLE {
+		return principal.PrincipalClassification.String()
+	}
+
+	role := &mspproto.MSPRole{}
+	if err := proto.Unmarshal(principal.Principal, role); err != nil {
+		return "?"
+	}
+	return role.MspIdentifier + "." + strings.ToLower(role.Role.String())
+}
@@ -0,0 +1,488 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QR 码(ISO/IEC 18004), 以字节模式及纠错等级 M 编码, 支持版本 1 至 10(最多 213 字节)
+type QRCode struct {
+	Size	int	// 每边的模块数
+	Modules	[][]bool	// [行][列], true 为深色
+}
+
+// 纠错等级 M 下各版本的分块: 每块数据码字数及纠错码字数
+type qrBlocks struct {
+	ecPerBlock	int
+	groups	[][2]int	// {块数, 每块数据码字数}
+}
+
+var qrVersionsM = []qrBlocks{
+	1: {10, [][2]int{{1, 16}}},
+	2: {16, [][2]int{{1, 28}}},
+	3: {26, [][2]int{{1, 44}}},
+	4: {18, [][2]int{{2, 32}}},
+	5: {24, [][2]int{{2, 43}}},
+	6: {16, [][2]int{{4, 27}}},
+	7: {18, [][2]int{{4, 31}}},
+	8: {22, [][2]int{{2, 38}, {2, 39}}},
+	9: {22, [][2]int{{3, 36}, {2, 37}}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+// 各版本校正图形的中心坐标
+var qrAlignment = [][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+func (b qrBlocks) dataCodewords() int {
+	n := 0
+	for _, g := range b.groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// 将文本编码为 QR 码, 自动选择能容纳内容的最小版本
+func EncodeQR(text string) (*QRCode, error) {
+	data := []byte(text)
+
+	version := 0
+	for v := 1; v < len(qrVersionsM); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrVersionsM[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("内容过长, 无法编码为二维码: %d 字节", len(data))
+	}
+
+	codewords := qrCodewords(data, version)
+
+	var best *qrMatrix
+	bestPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		m := newQRMatrix(version)
+		m.place(codewords)
+		m.applyMask(mask)
+		m.drawFormat(mask)
+		if p := m.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = m, p
+		}
+	}
+
+	return &QRCode{Size: best.size, Modules: best.dark}, nil
+}
+
+// 以 SVG 输出, scale 为每个模块的像素数, 四周保留 4 个模块的空白区
+func (q *QRCode) SVG(scale int) string {
+	const quiet = 4
+	n := (q.Size + 2*quiet) * scale
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n, q.Size+2*quiet, q.Size+2*quiet)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range q.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
+
+// 生成数据码字及纠错码字, 并按分块交错排列
+func qrCodewords(data []byte, version int) []byte {
+	blocks := qrVersionsM[version]
+	capacity := blocks.dataCodewords()
+
+	var bits qrBits
+	bits.append(0x4, 4)	// 字节模式
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, c := range data {
+		bits.append(int(c), 8)
+	}
+
+	// 终止符及补齐至整字节, 剩余部分交替填充 0xEC 0x11
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	for pad := 0; len(bits) < capacity*8; pad++ {
+		if pad%2 == 0 {
+			bits.append(0xec, 8)
+		} else {
+			bits.append(0x11, 8)
+		}
+	}
+	dataBytes := bits.bytes()
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, g := range blocks.groups {
+		for i := 0; i < g[0]; i++ {
+			block := dataBytes[offset : offset+g[1]]
+			offset += g[1]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, rsEncode(block, blocks.ecPerBlock))
+		}
+	}
+
+	var result []byte
+	for _, group := range [][][]byte{dataBlocks, ecBlocks} {
+		maxLen := 0
+		for _, b := range group {
+			if len(b) > maxLen {
+				maxLen = len(b)
+			}
+		}
+		for i := 0; i < maxLen; i++ {
+			for _, b := range group {
+				if i < len(b) {
+					result = append(result, b[i])
+				}
+			}
+		}
+	}
+	return result
+}
+
+type qrBits []bool
+
+func (b *qrBits) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>uint(i)&1 == 1)
+	}
+}
+
+func (b qrBits) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return out
+}
+
+// GF(256) 上的运算, 本原多项式 x^8+x^4+x^3+x^2+1
+var gfExp, gfLog = func() ([512]byte, [256]int) {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+// Reed-Solomon 纠错码字
+func rsEncode(data []byte, n int) []byte {
+	// 生成多项式 (x-α^0)(x-α^1)...(x-α^(n-1)), 系数由高次到低次
+	gen := []byte{1}
+	for i := 0; i < n; i++ {
+		next := make([]byte, len(gen)+1)
+		for j, c := range gen {
+			next[j] ^= c
+			next[j+1] ^= gfMul(c, gfExp[i])
+		}
+		gen = next
+	}
+
+	rem := make([]byte, n)
+	for _, d := range data {
+		factor := d ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for j := 0; j < n; j++ {
+			rem[j] ^= gfMul(gen[j+1], factor)
+		}
+	}
+	return rem
+}
+
+type qrMatrix struct {
+	version	int
+	size	int
+	dark	[][]bool
+	reserved	[][]bool	// 功能图形及格式信息所在的模块, 不放置数据也不掩模
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	size := 17 + 4*version
+	m := &qrMatrix{version: version, size: size}
+	m.dark = make([][]bool, size)
+	m.reserved = make([][]bool, size)
+	for i := range m.dark {
+		m.dark[i] = make([]bool, size)
+		m.reserved[i] = make([]bool, size)
+	}
+
+	// 位置探测图形及分隔符
+	for _, p := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := -1; dy <= 7; dy++ {
+			for dx := -1; dx <= 7; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if x < 0 || y < 0 || x >= size || y >= size {
+					continue
+				}
+				ring := dx == 0 || dx == 6 || dy == 0 || dy == 6
+				center := dx >= 2 && dx <= 4 && dy >= 2 && dy <= 4
+				inside := dx >= 0 && dx <= 6 && dy >= 0 && dy <= 6
+				m.set(x, y, inside && (ring || center))
+			}
+		}
+	}
+
+	// 定位图形
+	for i := 8; i < size-8; i++ {
+		m.set(i, 6, i%2 == 0)
+		m.set(6, i, i%2 == 0)
+	}
+
+	// 校正图形, 与位置探测图形重叠的位置除外
+	if version >= 2 {
+		pos := qrAlignment[version]
+		last := len(pos) - 1
+		for i, cy := range pos {
+			for j, cx := range pos {
+				if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+					continue
+				}
+				for dy := -2; dy <= 2; dy++ {
+					for dx := -2; dx <= 2; dx++ {
+						m.set(cx+dx, cy+dy, dx == -2 || dx == 2 || dy == -2 || dy == 2 || (dx == 0 && dy == 0))
+					}
+				}
+			}
+		}
+	}
+
+	// 格式信息区域(稍后写入)及固定的深色模块
+	for i := 0; i <= 8; i++ {
+		m.reserve(8, i)
+		m.reserve(i, 8)
+	}
+	for i := 0; i < 8; i++ {
+		m.reserve(size-1-i, 8)
+		m.reserve(8, size-1-i)
+	}
+	m.set(8, size-8, true)
+
+	// 版本信息(版本 7 及以上)
+	if version >= 7 {
+		info := version << 12 | bchRemainder(version, 0x1f25, 12)
+		for i := 0; i < 18; i++ {
+			bit := info>>uint(i)&1 == 1
+			a, b := size-11+i%3, i/3
+			m.set(a, b, bit)
+			m.set(b, a, bit)
+		}
+	}
+	return m
+}
+
+func (m *qrMatrix) set(x, y int, dark bool) {
+	m.dark[y][x] = dark
+	m.reserved[y][x] = true
+}
+
+func (m *qrMatrix) reserve(x, y int) {
+	m.reserved[y][x] = true
+}
+
+// 从右下角开始, 每两列为一组上下交替放置数据位
+func (m *qrMatrix) place(codewords []byte) {
+	i := 0
+	total := len(codewords) * 8
+	upward := true
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for k := 0; k < m.size; k++ {
+			y := k
+			if upward {
+				y = m.size - 1 - k
+			}
+			for _, x := range []int{right, right - 1} {
+				if m.reserved[y][x] {
+					continue
+				}
+				if i < total {
+					m.dark[y][x] = codewords[i/8]>>uint(7-i%8)&1 == 1
+				}
+				i++
+			}
+		}
+		upward = !upward
+	}
+}
+
+func qrMask(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (m *qrMatrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if !m.reserved[y][x] && qrMask(mask, x, y) {
+				m.dark[y][x] = !m.dark[y][x]
+			}
+		}
+	}
+}
+
+// 写入格式信息: 纠错等级 M(00)及掩模编号, 以 BCH(15,5) 编码
+func (m *qrMatrix) drawFormat(mask int) {
+	data := 0<<3 | mask
+	info := (data<<10 | bchRemainder(data, 0x537, 10)) ^ 0x5412
+
+	bit := func(i int) bool { return info>>uint(i)&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		m.dark[i][8] = bit(i)
+	}
+	m.dark[7][8] = bit(6)
+	m.dark[8][8] = bit(7)
+	m.dark[8][7] = bit(8)
+	for i := 9; i < 15; i++ {
+		m.dark[8][14-i] = bit(i)
+	}
+	for i := 0; i < 8; i++ {
+		m.dark[8][m.size-1-i] = bit(i)
+	}
+	for i := 8; i < 15; i++ {
+		m.dark[m.size-15+i][8] = bit(i)
+	}
+}
+
+func bchRemainder(data, poly, degree int) int {
+	r := data << uint(degree)
+	for i := 31; i >= degree; i-- {
+		if r>>uint(i)&1 == 1 {
+			r ^= poly << uint(i-degree)
+		}
+	}
+	return r
+}
+
+// 掩模评分, 按标准中的四条规则计算, 分数越低越好
+func (m *qrMatrix) penalty() int {
+	n := m.size
+	score := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return m.dark[x][y]
+		}
+		return m.dark[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			// 规则 1: 同色连续 5 个及以上的模块
+			run := 1
+			for x := 1; x < n; x++ {
+				if at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				score += run - 2
+			}
+
+			// 规则 3: 类似位置探测图形的 1:1:3:1:1 图案
+			for x := 0; x+11 <= n; x++ {
+				var v [11]bool
+				for k := range v {
+					v[k] = at(x+k, y, vertical)
+				}
+				if v[4] && !v[5] && v[6] && v[7] && v[8] && !v[9] && v[10] && !v[0] && !v[1] && !v[2] && !v[3] {
+					score += 40
+				}
+				if v[0] && !v[1] && v[2] && v[3] && v[4] && !v[5] && v[6] && !v[7] && !v[8] && !v[9] && !v[10] {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// 规则 2: 2x2 同色块
+	darkCount := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if m.dark[y][x] {
+				darkCount++
+			}
+			if x+1 < n && y+1 < n {
+				c := m.dark[y][x]
+				if m.dark[y][x+1] == c && m.dark[y+1][x] == c && m.dark[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// 规则 4: 深色模块比例偏离 50%
+	percent := darkCount * 100 / (n * n)
+	deviation := percent - 50
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	score += deviation / 5 * 10
+	return score
+}
@@ -0,0 +1,310 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 空内容的 SHA-256, 用于无请求体的请求签名
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 兼容的对象存储(AWS S3、MinIO 等), 请求以 AWS 签名 V4 认证
+type S3Store struct {
+	Endpoint	string	// 如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region	string
+	Bucket	string
+	Prefix	string	// 对象键的前缀, 如 photos/
+	AccessKey	string
+	SecretKey	string
+	PathStyle	bool	// 以 endpoint/bucket/key 访问, MinIO 等通常需要
+	Client	*http.Client
+
+	now	func() time.Time
+}
+
+func NewS3Store(endpoint, region, bucket, prefix, accessKey, secretKey string, pathStyle bool) (*S3Store, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("无效的对象存储地址: %s", endpoint)
+	}
+	if bucket == "" || region == "" {
+		return nil, fmt.Errorf("对象存储的 bucket 及 region 不能为空")
+	}
+	return &S3Store{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Region: region,
+		Bucket: bucket,
+		Prefix: prefix,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: pathStyle,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		now: time.Now,
+	}, nil
+}
+
+func (s *S3Store) Put(data []byte) (string, error) {
+	digest := BlobDigest(data)
+
+	// 相同内容已存在时不再上传
+	resp, err := s.do(http.MethodHead, s.Prefix+digest, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return digest, nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return "", s.error(resp)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", http.DetectContentType(data))
+	resp, err = s.do(http.MethodPut, s.Prefix+digest, nil, header, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s.error(resp)
+	}
+	return digest, nil
+}
+
+func (s *S3Store) Open(digest string) (io.ReadCloser, error) {
+	if !ValidDigest(digest) {
+		return nil, ErrBlobNotFound
+	}
+
+	resp, err := s.do(http.MethodGet, s.Prefix+digest, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	defer resp.Body.Close()
+	return nil, s.error(resp)
+}
+
+func (s *S3Store) Delete(digest string) error {
+	if !ValidDigest(digest) {
+		return nil
+	}
+
+	resp, err := s.do(http.MethodDelete, s.Prefix+digest, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.error(resp)
+	}
+	return nil
+}
+
+// ListObjectsV2 的响应
+type listBucketResult struct {
+	Contents	[]struct {
+		Key	string
+		Size	int64
+		LastModified	time.Time
+	}
+	IsTruncated	bool
+	NextContinuationToken	string
+}
+
+func (s *S3Store) List() ([]BlobInfo, error) {
+	var list []BlobInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = s.error(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析对象列表失败: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			digest := strings.TrimPrefix(c.Key, s.Prefix)
+			if ValidDigest(digest) {
+				list = append(list, BlobInfo{Digest: digest, Size: c.Size, ModTime: c.LastModified})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(list, func(i, k int) bool { return list[i].Digest < list[k].Digest })
+	return list, nil
+}
+
+// 发送签名后的请求, key 为空时请求 bucket 本身
+func (s *S3Store) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, _ := url.Parse(s.Endpoint)
+	if s.PathStyle {
+		u.Path += "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	s.sign(req, payloadHash)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("访问对象存储失败: %v", err)
+	}
+	return resp, nil
+}
+
+// 对象存储返回的错误, 如 <Error><Code>AccessDenied</Code><Message>...</Message></Error>
+func (s *S3Store) error(resp *http.Response) error {
+	var e struct {
+		Code	string
+		Message	string
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return fmt.Errorf("对象存储返回错误: %s %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("对象存储返回错误: %s", resp.Status)
+}
+
+// 按 AWS 签名 V4 为请求添加 Authorization 头, 请求中已有的头均参与签名
+func (s *S3Store) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 规范化的请求头: 小写名称排序, 值去除首尾空白
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// 查询参数按名称排序, 名称与值均按 RFC 3986 编码
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// 除字母、数字及 -_.~ 外均编码为 %XX; 路径中的 / 不编码
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,245 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// 学校签名的字段, 与链码一致: 承诺字段及照片地址; 撤销标记、承诺等由链码写入的字段不参与签名
+var SignedFields = append(append([]string{}, CommitFields...), "Photo")
+
+// 由 fabric-ca 登记在证书中的所属学校, 与链码一致; 签名证书的学校须与信息中的学校一致
+const SchoolAttr = "edu.school"
+
+// fabric-ca 保存证书属性的扩展, 内容为 {"attrs": {...}}
+var attrsOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// 信息的规范化序列化: 以签名字段为键、按键排序的紧凑 JSON 对象, 不转义 HTML 字符
+func CanonicalEdu(edu Education) []byte {
+	fields := make(map[string]string, len(SignedFields))
+	for _, name := range SignedFields {
+		fields[name] = edu.Field(name)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(fields)
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// 签名学历信息的 Fabric 身份, 与签名交易的身份相同
+type Signer struct {
+	ctx	context.Client
+}
+
+// 使用 SDK 凭证存储中指定用户的私钥及证书
+func NewSigner(sdk *fabsdk.FabricSDK, user, org string) (*Signer, error) {
+	ctx, err := sdk.Context(fabsdk.WithUser(user), fabsdk.WithOrg(org))()
+	if err != nil {
+		return nil, fmt.Errorf("加载签名身份 %s 失败: %v", user, err)
+	}
+	return &Signer{ctx: ctx}, nil
+}
+
+// PEM 格式的签名证书
+func (s *Signer) Certificate() string {
+	return string(s.ctx.EnrollmentCertificate())
+}
+
+// 对数据的 SHA-256 摘要签名, 返回 DER 格式的 ECDSA 签名
+func (s *Signer) signBytes(msg []byte) ([]byte, error) {
+	return s.ctx.SigningManager().Sign(msg, s.ctx.PrivateKey())
+}
+
+// 签名证书登记的所属学校
+func (s *Signer) School() (string, bool) {
+	block, _ := pem.Decode(s.ctx.EnrollmentCertificate())
+	if block == nil {
+		return "", false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", false
+	}
+	return CertSchool(cert)
+}
+
+// 对信息的规范化序列化签名, 签名为 SHA-256 摘要的 ECDSA 签名(DER), 以 base64 保存
+// 签名身份须属于信息中的学校
+func (s *Signer) Sign(edu *Education) error {
+	if school, ok := s.School(); !ok || school != edu.SchoolName {
+		return fmt.Errorf("签名身份不属于学校 %s, 请由管理员为本校登记员注册 Fabric 身份", edu.SchoolName)
+	}
+
+	sig, err := s.signBytes(CanonicalEdu(*edu))
+	if err != nil {
+		return fmt.Errorf("签名信息失败: %v", err)
+	}
+	edu.Signature = base64.StdEncoding.EncodeToString(sig)
+	edu.SignerCert = s.Certificate()
+	return nil
+}
+
+// 添加及修改信息时由学校身份签名; ECDSA 签名每次不同, 重新提交相同幂等键的调用时
+// 若信息未变则沿用发件箱中记录的签名, 使调用参数保持不变
+func (t *ServiceSetup) withSignature(key, fcn string, args [][]byte) ([][]byte, error) {
+	if t.Signer == nil || (fcn != "addEdu" && fcn != "updateEdu") || len(args) == 0 {
+		return args, nil
+	}
+
+	var edu Education
+	if err := json.Unmarshal(args[0], &edu); err != nil {
+		return nil, fmt.Errorf("指定的edu对象反序列化时发生错误: %v", err)
+	}
+
+	if prev, ok := t.signedBefore(key, fcn, edu); ok {
+		edu.Signature, edu.SignerCert = prev.Signature, prev.SignerCert
+	} else if err := t.Signer.Sign(&edu); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(edu)
+	if err != nil {
+		return nil, fmt.Errorf("指定的edu对象序列化时发生错误: %v", err)
+	}
+	return append([][]byte{b}, args[1:]...), nil
+}
+
+// 发件箱中相同幂等键的调用已由同一身份签名且信息未变时, 返回当时提交的信息
+func (t *ServiceSetup) signedBefore(key, fcn string, edu Education) (Education, bool) {
+	if t.Outbox == nil {
+		return Education{}, false
+	}
+	e, ok := t.Outbox.Get(key)
+	if !ok || e.Fcn != fcn || len(e.Args) == 0 {
+		return Education{}, false
+	}
+
+	var prev Education
+	if err := json.Unmarshal([]byte(e.Args[0]), &prev); err != nil {
+		return Education{}, false
+	}
+	return prev, prev.Signature != "" && prev.SignerCert == t.Signer.Certificate() && bytes.Equal(CanonicalEdu(prev), CanonicalEdu(edu))
+}
+
+// 离线核验信息的学校签名, 不需要访问账本及网络, 返回签名证书
+// trusted 为学校的证书或签发学校证书的 CA 证书, 为空时只核验签名与信息一致
+func VerifyEduSignature(edu Education, trusted []*x509.Certificate) (*x509.Certificate, error) {
+	if edu.Signature == "" || edu.SignerCert == "" {
+		return nil, fmt.Errorf("信息没有学校签名")
+	}
+
+	block, _ := pem.Decode([]byte(edu.SignerCert))
+	if block == nil {
+		return nil, fmt.Errorf("签名证书格式错误")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名证书失败: %v", err)
+	}
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("签名证书不是 ECDSA 证书")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(edu.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("签名格式错误: %v", err)
+	}
+	var sig struct {
+		R, S	*big.Int
+	}
+	if rest, err := asn1.Unmarshal(der, &sig); err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return nil, fmt.Errorf("签名格式错误")
+	}
+	digest := sha256.Sum256(CanonicalEdu(edu))
+	if !ecdsa.Verify(pub, digest[:], sig.R, sig.S) {
+		return nil, fmt.Errorf("签名与信息不一致, 信息可能已被篡改")
+	}
+	if school, ok := CertSchool(cert); !ok || school != edu.SchoolName {
+		return nil, fmt.Errorf("签名证书不属于学校 %s", edu.SchoolName)
+	}
+
+	if err := verifyCertificate(cert, trusted); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// 证书中登记的所属学校, 没有该属性时返回 false
+func CertSchool(cert *x509.Certificate) (string, bool) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(attrsOID) {
+			continue
+		}
+		var attrs struct {
+			Attrs	map[string]string	`json:"attrs"`
+		}
+		if err := json.Unmarshal(ext.Value, &attrs); err != nil {
+			return "", false
+		}
+		school, ok := attrs.Attrs[SchoolAttr]
+		return school, ok
+	}
+	return "", false
+}
+
+// 核验证书是指定的证书之一或由其签发, trusted 为空时不核验
+func verifyCertificate(cert *x509.Certificate, trusted []*x509.Certificate) error {
+	if len(trusted) == 0 {
+		return nil
+	}
+	roots := x509.NewCertPool()
+	for _, c := range trusted {
+		if c.Equal(cert) {
+			return nil
+		}
+		roots.AddCert(c)
+	}
+	// 签名时间未知, 以证书生效时的证书链为准, 证书此后过期不影响已签名的信息
+	opts := x509.VerifyOptions{Roots: roots, CurrentTime: cert.NotBefore, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("签名证书不是由指定的学校证书签发: %v", err)
+	}
+	return nil
+}
+
+// 读取 PEM 文件中的全部证书
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析证书失败: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("文件中没有证书")
+	}
+	return certs, nil
+}
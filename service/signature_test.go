@@ -0,0 +1,256 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+)
+
+// 测试使用的 CA, 签发的证书以 fabric-ca 的方式登记属性
+type testCA struct {
+	key	*ecdsa.PrivateKey
+	cert	*x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key := newTestKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "ca.org1.kevin.kongyixueyuan.com"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	return &testCA{key: key, cert: createTestCert(t, tmpl, tmpl, key, key)}
+}
+
+// 签发证书, attrs 为空时不登记属性
+func (ca *testCA) issue(t *testing.T, key *ecdsa.PrivateKey, attrs map[string]string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{CommonName: "registrar"},
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}
+	if attrs != nil {
+		b, err := json.Marshal(map[string]map[string]string{"attrs": attrs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: attrsOID, Value: b}}
+	}
+	return createTestCert(t, tmpl, ca.cert, key, ca.key)
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func createTestCert(t *testing.T, tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// 以本地私钥代替 SDK 凭证存储的签名身份, 其余方法不会被调用
+type testClient struct {
+	context.Client
+	cert	[]byte
+	key	*ecdsa.PrivateKey
+}
+
+func (c testClient) EnrollmentCertificate() []byte {
+	return c.cert
+}
+
+func (c testClient) PrivateKey() core.Key {
+	return nil
+}
+
+func (c testClient) SigningManager() core.SigningManager {
+	return testSigningManager{c.key}
+}
+
+type testSigningManager struct {
+	key	*ecdsa.PrivateKey
+}
+
+func (m testSigningManager) Sign(msg []byte, _ core.Key) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, m.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
+
+// 由 ca 签发、登记了所属学校的签名身份
+func newTestSigner(t *testing.T, ca *testCA, school string) *Signer {
+	key := newTestKey(t)
+	var attrs map[string]string
+	if school != "" {
+		attrs = map[string]string{SchoolAttr: school}
+	}
+	return &Signer{ctx: testClient{cert: certPEM(ca.issue(t, key, attrs)), key: key}}
+}
+
+// 与链码测试相同的向量, 两端的规范化序列化须保持一致
+func TestCanonicalEdu(t *testing.T) {
+	edu := testEdu()
+	sum := sha256.Sum256(CanonicalEdu(edu))
+	if got := hex.EncodeToString(sum[:]); got != "8cc97294c7441f1af7e64690800d4fb3207c398055efd23fa35e9d11620e599b" {
+		t.Fatalf("CanonicalEdu() 的摘要为 %s", got)
+	}
+
+	// 链码写入的字段及签名本身不参与签名
+	written := edu
+	written.Revoked = true
+	written.RevokedBy = "registrar"
+	written.CommitRoot = "root"
+	written.Signature = "sig"
+	written.SignerCert = "cert"
+	if string(CanonicalEdu(written)) != string(CanonicalEdu(edu)) {
+		t.Fatalf("链码写入的字段影响了规范化序列化")
+	}
+
+	edu.Major = "<法学&>"
+	if !strings.Contains(string(CanonicalEdu(edu)), "<法学&>") {
+		t.Fatalf("规范化序列化转义了 HTML 字符: %s", CanonicalEdu(edu))
+	}
+}
+
+func TestSignerSign(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name	string
+		school	string
+		ok	bool
+	}{
+		{"本校身份", "中国政法大学", true},
+		{"其他学校的身份", "北京大学", false},
+		{"证书未登记学校", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edu := testEdu()
+			err := newTestSigner(t, ca, tt.school).Sign(&edu)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Sign() 错误为 %v", err)
+			}
+			if !tt.ok && edu.Signature != "" {
+				t.Fatalf("签名失败时不应写入签名")
+			}
+		})
+	}
+}
+
+func TestVerifyEduSignature(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	signer := newTestSigner(t, ca, "中国政法大学")
+
+	signed := testEdu()
+	if err := signer.Sign(&signed); err != nil {
+		t.Fatal(err)
+	}
+
+	// 以 school 的信息直接签名, 绕过 Signer.Sign 对证书中学校的检查
+	signWith := func(s *Signer, school string) Education {
+		edu := testEdu()
+		edu.SchoolName = school
+		der, err := s.signBytes(CanonicalEdu(edu))
+		if err != nil {
+			t.Fatal(err)
+		}
+		edu.Signature = base64.StdEncoding.EncodeToString(der)
+		edu.SignerCert = s.Certificate()
+		return edu
+	}
+	der, _ := base64.StdEncoding.DecodeString(signed.Signature)
+
+	tests := []struct {
+		name	string
+		edu	func() Education
+		trusted	[]*x509.Certificate
+		ok	bool
+	}{
+		{"签名有效", func() Education { return signed }, nil, true},
+		{"由信任的 CA 签发", func() Education { return signed }, []*x509.Certificate{ca.cert}, true},
+		{"信任签名证书本身", func() Education { return signed }, []*x509.Certificate{parseTestCert(t, signed.SignerCert)}, true},
+		{"由不信任的 CA 签发", func() Education { return signed }, []*x509.Certificate{otherCA.cert}, false},
+		{"修改签名字段", func() Education { e := signed; e.CertNo = "22222222222222"; return e }, nil, false},
+		{"修改照片", func() Education { e := signed; e.Photo = "/static/photo/22.png"; return e }, nil, false},
+		{"其他学校签名本校的信息", func() Education { return signWith(newTestSigner(t, ca, "北京大学"), "北京大学") }, nil, true},
+		{"证书登记了其他学校", func() Education { return signWith(newTestSigner(t, ca, "北京大学"), "中国政法大学") }, nil, false},
+		{"证书未登记学校", func() Education { return signWith(newTestSigner(t, ca, ""), "中国政法大学") }, nil, false},
+		{"替换为其他身份的证书", func() Education {
+			e := signed
+			e.SignerCert = newTestSigner(t, ca, "中国政法大学").Certificate()
+			return e
+		}, nil, false},
+		{"缺少签名", func() Education { e := signed; e.Signature = ""; return e }, nil, false},
+		{"签名不是 base64", func() Education { e := signed; e.Signature = "!" + e.Signature; return e }, nil, false},
+		{"签名后附加数据", func() Education {
+			e := signed
+			e.Signature = base64.StdEncoding.EncodeToString(append(append([]byte{}, der...), 0))
+			return e
+		}, nil, false},
+		{"证书格式错误", func() Education { e := signed; e.SignerCert = "cert"; return e }, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyEduSignature(tt.edu(), tt.trusted)
+			if (err == nil) != tt.ok {
+				t.Fatalf("VerifyEduSignature() 错误为 %v", err)
+			}
+		})
+	}
+}
+
+func parseTestCert(t *testing.T, data string) *x509.Certificate {
+	cert, err := parseCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -0,0 +1,121 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrBadToken = errors.New("访问令牌无效或已过期")
+
+// 访问令牌中的声明
+type Claims struct {
+	Subject	string	`json:"sub"`	// API 密钥编号
+	Org	string	`json:"org"`
+	Role	string	`json:"role"`
+	School	string	`json:"school,omitempty"`
+	IssuedAt	int64	`json:"iat"`
+	ExpiresAt	int64	`json:"exp"`
+}
+
+// 签发及校验以 HS256 签名的 JWT 访问令牌
+type TokenIssuer struct {
+	Secret	[]byte
+	TTL	time.Duration
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// 为 API 密钥签发访问令牌
+func (t *TokenIssuer) Issue(key APIKey) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(t.TTL)
+
+	claims := Claims{
+		Subject: key.ID,
+		Org: key.Org,
+		Role: key.Role,
+		School: key.School,
+		IssuedAt: now.Unix(),
+		ExpiresAt: expires.Unix(),
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(b)
+	return signingInput + "." + t.sign(signingInput), expires, nil
+}
+
+// 校验令牌的签名及有效期
+func (t *TokenIssuer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrBadToken
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(signingInput))) {
+		return nil, ErrBadToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrBadToken
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, ErrBadToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrBadToken
+	}
+	return claims, nil
+}
+
+func (t *TokenIssuer) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, t.Secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 读取令牌签名密钥, 文件不存在时生成新的密钥并保存, 使服务重启后已签发的令牌仍然有效
+func LoadTokenSecret(path string) ([]byte, error) {
+	return loadSecret(path, "令牌签名密钥")
+}
+
+// 读取派生各字段盐值的密钥, 文件不存在时生成; 密钥丢失后无法再为已有的信息生成披露包
+func LoadSaltKey(path string) ([]byte, error) {
+	return loadSecret(path, "盐值派生密钥")
+}
+
+func loadSecret(path, what string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		return b, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取%s失败: %v", what, err)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(secret), 0600); err != nil {
+		return nil, fmt.Errorf("保存%s失败: %v", what, err)
+	}
+	return []byte(secret), nil
+}
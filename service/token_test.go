@@ -0,0 +1,81 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenVerify(t *testing.T) {
+	issuer := &TokenIssuer{Secret: []byte("secret"), TTL: time.Hour}
+	key := APIKey{ID: "0123456789abcdef", Org: "某大学", Role: RoleRegistrar, School: "某大学"}
+
+	token, expires, err := issuer.Issue(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= 59*time.Minute || d > time.Hour {
+		t.Fatalf("有效期为 %v, 应为 1 小时", d)
+	}
+	parts := strings.Split(token, ".")
+
+	// 以相同密钥签名但声明不同的令牌
+	forge := func(c Claims) string {
+		b, _ := json.Marshal(c)
+		input := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(b)
+		return input + "." + issuer.sign(input)
+	}
+	now := time.Now()
+	claims := Claims{Subject: key.ID, Role: key.Role, IssuedAt: now.Add(-2 * time.Hour).Unix()}
+
+	expired := claims
+	expired.ExpiresAt = now.Add(-time.Second).Unix()
+	expiresNow := claims
+	expiresNow.ExpiresAt = now.Unix()
+	valid := claims
+	valid.ExpiresAt = now.Add(time.Minute).Unix()
+
+	other := &TokenIssuer{Secret: []byte("other"), TTL: time.Hour}
+	otherToken, _, err := other.Issue(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name	string
+		token	string
+		ok	bool
+	}{
+		{"新签发", token, true},
+		{"即将过期", forge(valid), true},
+		{"已过期", forge(expired), false},
+		{"恰好到期", forge(expiresNow), false},
+		{"其他密钥签名", otherToken, false},
+		{"篡改载荷", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x","role":"admin","exp":9999999999}`)) + "." + parts[2], false},
+		{"alg 为 none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", false},
+		{"缺少签名", parts[0] + "." + parts[1], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := issuer.Verify(tt.token)
+			if !tt.ok {
+				if err != ErrBadToken {
+					t.Fatalf("Verify() 错误为 %v, 应为 ErrBadToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() 失败: %v", err)
+			}
+			if got.Subject != key.ID || got.Role != key.Role {
+				t.Fatalf("Verify() 返回了错误的声明 %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码的最小长度
+const MinPasswordLength = 8
+
+// 角色
+const (
+	RoleRegistrar = "registrar"	// 登记员: 添加及修改本校的学历信息
+	RoleAuditor = "auditor"	// 审计员: 查询信息、历史记录及区块浏览
+	RoleVerifier = "verifier"	// 核验员: 仅能根据证书编号与姓名查询, 供用人单位使用
+	RoleAdmin = "admin"	// 管理员: 用户、身份及网络管理
+	RoleHolder = "holder"	// 持证人: 查看本人的学历信息并生成在线验证码
+)
+
+// 可分配的角色
+var Roles = []string{RoleRegistrar, RoleAuditor, RoleVerifier, RoleAdmin, RoleHolder}
+
+// 登录名或密码错误, 账号已停用时同样返回此错误, 以免泄露账号状态
+var ErrBadCredentials = errors.New("用户名或密码错误")
+
+// Web 账号, 密码以 bcrypt 哈希保存
+type Account struct {
+	LoginName	string
+	PasswordHash	string
+	Roles	[]string
+	School	string	// 所属学校, 登记员只能管理本校的学历信息
+	EntityID	string	`json:",omitempty"`	// 持证人本人的身份证号
+	Disabled	bool
+	CreatedAt	time.Time
+	UpdatedAt	time.Time
+}
+
+func (a Account) HasRole(role string) bool {
+	for _, r := range a.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// 保存在本地 JSON 文件中的账号存储, 每次修改后整体写回文件
+type UserStore struct {
+	Path	string
+
+	mu	sync.Mutex
+	accounts	map[string]*Account
+}
+
+// 打开账号存储, 文件不存在时为空存储, 需通过首次运行流程创建管理员
+func OpenUserStore(path string) (*UserStore, error) {
+	s := &UserStore{Path: path, accounts: make(map[string]*Account)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取账号文件失败: %v", err)
+	}
+
+	var list []*Account
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("解析账号文件失败: %v", err)
+	}
+	for _, a := range list {
+		s.accounts[a.LoginName] = a
+	}
+	return s, nil
+}
+
+// 是否还没有任何账号
+func (s *UserStore) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.accounts) == 0
+}
+
+// 按登录名排序返回所有账号
+func (s *UserStore) List() []Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LoginName < list[j].LoginName })
+	return list
+}
+
+func (s *UserStore) Get(loginName string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.accounts[loginName]; ok {
+		return *a, true
+	}
+	return Account{}, false
+}
+
+// 校验登录名及密码, 已停用的账号无法登录
+func (s *UserStore) Authenticate(loginName, password string) (Account, error) {
+	a, ok := s.Get(loginName)
+	if !ok {
+		// 账号不存在时同样计算一次哈希, 避免通过响应时间判断账号是否存在
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Account{}, ErrBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) != nil || a.Disabled {
+		return Account{}, ErrBadCredentials
+	}
+	return a, nil
+}
+
+// 创建账号
+func (s *UserStore) Create(loginName, password string, roles []string, school, entityID string) error {
+	return s.create(loginName, password, roles, school, entityID, false)
+}
+
+// 首次运行时创建初始管理员, 已存在任何账号时返回错误
+func (s *UserStore) CreateInitialAdmin(loginName, password string) error {
+	return s.create(loginName, password, []string{RoleAdmin}, "", "", true)
+}
+
+func (s *UserStore) create(loginName, password string, roles []string, school, entityID string, initial bool) error {
+	loginName = strings.TrimSpace(loginName)
+	if loginName == "" {
+		return fmt.Errorf("登录名不能为空")
+	}
+	school, entityID = strings.TrimSpace(school), strings.TrimSpace(entityID)
+	if err := validRoles(roles, school, entityID); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if initial && len(s.accounts) > 0 {
+		return fmt.Errorf("已存在管理员账号")
+	}
+	if _, ok := s.accounts[loginName]; ok {
+		return fmt.Errorf("账号 %s 已存在", loginName)
+	}
+
+	now := time.Now()
+	s.accounts[loginName] = &Account{LoginName: loginName, PasswordHash: hash, Roles: roles, School: school, EntityID: entityID, CreatedAt: now, UpdatedAt: now}
+	if err := s.save(); err != nil {
+		delete(s.accounts, loginName)
+		return err
+	}
+	return nil
+}
+
+// 重置密码
+func (s *UserStore) SetPassword(loginName, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.update(loginName, func(a *Account) error {
+		a.PasswordHash = hash
+		return nil
+	})
+}
+
+// 用户修改自己的密码, 需提供原密码
+func (s *UserStore) ChangePassword(loginName, oldPassword, newPassword string) error {
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.update(loginName, func(a *Account) error {
+		if bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(oldPassword)) != nil {
+			return fmt.Errorf("原密码不正确")
+		}
+		a.PasswordHash = hash
+		return nil
+	})
+}
+
+// 停用或启用账号
+func (s *UserStore) SetDisabled(loginName string, disabled bool) error {
+	return s.update(loginName, func(a *Account) error {
+		if disabled && a.HasRole(RoleAdmin) && s.activeAdmins() == 1 {
+			return fmt.Errorf("不能停用唯一的管理员")
+		}
+		a.Disabled = disabled
+		return nil
+	})
+}
+
+// 设置账号的角色、所属学校及持证人的身份证号
+func (s *UserStore) SetRoles(loginName string, roles []string, school, entityID string) error {
+	school, entityID = strings.TrimSpace(school), strings.TrimSpace(entityID)
+	if err := validRoles(roles, school, entityID); err != nil {
+		return err
+	}
+
+	return s.update(loginName, func(a *Account) error {
+		removesAdmin := a.HasRole(RoleAdmin) && !Account{Roles: roles}.HasRole(RoleAdmin)
+		if removesAdmin && !a.Disabled && s.activeAdmins() == 1 {
+			return fmt.Errorf("不能移除唯一的管理员")
+		}
+		a.Roles = roles
+		a.School = school
+		a.EntityID = entityID
+		return nil
+	})
+}
+
+// 修改指定账号并写回文件, fn 返回错误时不做任何修改
+func (s *UserStore) update(loginName string, fn func(a *Account) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[loginName]
+	if !ok {
+		return fmt.Errorf("账号 %s 不存在", loginName)
+	}
+
+	updated := *a
+	if err := fn(&updated); err != nil {
+		return err
+	}
+	updated.UpdatedAt = time.Now()
+	s.accounts[loginName] = &updated
+
+	if err := s.save(); err != nil {
+		s.accounts[loginName] = a
+		return err
+	}
+	return nil
+}
+
+// 未停用的管理员数量, 调用方需持有锁
+func (s *UserStore) activeAdmins() int {
+	n := 0
+	for _, a := range s.accounts {
+		if a.HasRole(RoleAdmin) && !a.Disabled {
+			n++
+		}
+	}
+	return n
+}
+
+// 将账号写入文件, 调用方需持有锁
+func (s *UserStore) save() error {
+	list := make([]*Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LoginName < list[j].LoginName })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存账号文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("保存账号文件失败: %v", err)
+	}
+	return nil
+}
+
+// 用于账号不存在时的比较, 使其耗时与正常校验一致
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("education"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	if len([]rune(password)) < MinPasswordLength {
+		return "", fmt.Errorf("密码长度不能少于 %d 位", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("计算密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
+
+// 校验角色, 登记员必须指定所属学校, 持证人必须指定本人的身份证号
+func validRoles(roles []string, school, entityID string) error {
+	for _, role := range roles {
+		known := false
+		for _, r := range Roles {
+			if r == role {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("未知的角色: %s", role)
+		}
+		if role == RoleRegistrar && school == "" {
+			return fmt.Errorf("登记员必须指定所属学校")
+		}
+		if role == RoleHolder && entityID == "" {
+			return fmt.Errorf("持证人必须指定本人的身份证号")
+		}
+	}
+	return nil
+}
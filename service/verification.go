@@ -0,0 +1,235 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 在线验证码的字符集, 去除了易混淆的 0、O、1、I
+const verifyAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// 过期超过此时长的验证码在服务重启时清除, 此前查询时提示已过期
+const verificationRetention = 90 * 24 * time.Hour
+
+// 在线验证码, 对应生成时账本中的信息版本, 由持证人生成或随备案表生成
+type Verification struct {
+	Code	string	// 如 ABCD-EFGH-JKLM-NPQR
+	EntityID	string
+	Name	string
+	CertNo	string
+	SchoolName	string
+	TxID	string	// 生成时信息的最新交易编号
+	Fields	[]string	// 验证页面公开的字段, 学校名称始终公开
+	CreatedBy	string
+	CreatedAt	time.Time
+	ExpiresAt	time.Time
+	Withdrawn	bool	`json:",omitempty"`	// 持证人已提前作废
+}
+
+func (v Verification) Expired() bool {
+	return time.Now().After(v.ExpiresAt)
+}
+
+// 验证码是否仍可用于查询
+func (v Verification) Valid() bool {
+	return !v.Withdrawn && !v.Expired()
+}
+
+// 是否公开指定的字段
+func (v Verification) Discloses(field string) bool {
+	for _, f := range v.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// 保存在本地 JSON 文件中的验证码
+type VerificationStore struct {
+	Path	string
+	TTL	time.Duration	// 验证码的最长有效期
+
+	mu	sync.Mutex
+	codes	map[string]*Verification	// 键为去除分隔符的验证码
+}
+
+func OpenVerificationStore(path string) (*VerificationStore, error) {
+	s := &VerificationStore{Path: path, TTL: 30 * 24 * time.Hour, codes: make(map[string]*Verification)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取验证码文件失败: %v", err)
+	}
+
+	var list []*Verification
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("解析验证码文件失败: %v", err)
+	}
+	for _, v := range list {
+		if time.Since(v.ExpiresAt) > verificationRetention {
+			continue
+		}
+		// 此前版本只随备案表生成验证码, 公开全部字段
+		if v.Fields == nil {
+			v.Fields = AllFields()
+		}
+		s.codes[normalizeCode(v.Code)] = v
+	}
+	return s, nil
+}
+
+// 为信息的当前版本生成验证码, fields 为公开的字段, ttl 不大于 0 或超过 TTL 时使用 TTL
+func (s *VerificationStore) Create(edu Education, txID, createdBy string, fields []string, ttl time.Duration) (Verification, error) {
+	fields, err := ValidFields(fields)
+	if err != nil {
+		return Verification{}, err
+	}
+	if ttl <= 0 || ttl > s.TTL {
+		ttl = s.TTL
+	}
+	code, err := newVerifyCode()
+	if err != nil {
+		return Verification{}, err
+	}
+
+	now := time.Now()
+	v := &Verification{
+		Code: code,
+		EntityID: edu.EntityID,
+		Name: edu.Name,
+		CertNo: edu.CertNo,
+		SchoolName: edu.SchoolName,
+		TxID: txID,
+		Fields: fields,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := normalizeCode(code)
+	if _, ok := s.codes[key]; ok {
+		return Verification{}, fmt.Errorf("验证码重复, 请重试")
+	}
+	s.codes[key] = v
+	if err := s.save(); err != nil {
+		delete(s.codes, key)
+		return Verification{}, err
+	}
+	return *v, nil
+}
+
+// 根据验证码查找, 忽略大小写、空格及分隔符
+func (s *VerificationStore) Get(code string) (Verification, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.codes[normalizeCode(code)]
+	if !ok {
+		return Verification{}, false
+	}
+	return *v, true
+}
+
+// 作废验证码, 只能作废指定信息的验证码
+func (s *VerificationStore) Withdraw(code, entityID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.codes[normalizeCode(code)]
+	if !ok || v.EntityID != entityID {
+		return fmt.Errorf("验证码不存在")
+	}
+	if v.Withdrawn {
+		return nil
+	}
+
+	v.Withdrawn = true
+	if err := s.save(); err != nil {
+		v.Withdrawn = false
+		return err
+	}
+	return nil
+}
+
+// 返回信息的全部验证码, 最近生成的在前
+func (s *VerificationStore) List(entityID string) []Verification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Verification
+	for _, v := range s.codes {
+		if v.EntityID == entityID {
+			list = append(list, *v)
+		}
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.After(list[k].CreatedAt) })
+	return list
+}
+
+// 将验证码写入文件, 调用方需持有锁
+func (s *VerificationStore) save() error {
+	list := make([]*Verification, 0, len(s.codes))
+	for _, v := range s.codes {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.Before(list[k].CreatedAt) })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("保存验证码文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("保存验证码文件失败: %v", err)
+	}
+	return nil
+}
+
+// 生成 16 位验证码(80 位随机数), 每 4 位以 - 分隔
+func newVerifyCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成验证码失败: %v", err)
+	}
+
+	var code strings.Builder
+	for i, c := range b {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(verifyAlphabet[int(c)%len(verifyAlphabet)])
+	}
+	return code.String(), nil
+}
+
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
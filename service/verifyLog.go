@@ -0,0 +1,72 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 公开验证页面的一次查询
+type VerifyLookup struct {
+	Time	time.Time
+	IP	string
+	UserAgent	string	`json:",omitempty"`
+	Via	string	// page、api 或 photo
+	Code	string	// 查询时输入的验证码
+	EntityID	string	`json:",omitempty"`	// 验证码对应的信息
+	Result	string	// 查询结果, 如 active、revoked、expired、not_found、rate_limited
+}
+
+// 以 JSON Lines 格式追加写入本地文件的查询日志
+type VerifyLog struct {
+	Path	string
+
+	mu	sync.Mutex
+	file	*os.File
+}
+
+func OpenVerifyLog(path string) (*VerifyLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开验证查询日志失败: %v", err)
+	}
+	return &VerifyLog{Path: path, file: f}, nil
+}
+
+// 记录一次查询, Time 为空时使用当前时间
+func (l *VerifyLog) Record(lookup VerifyLookup) error {
+	if lookup.Time.IsZero() {
+		lookup.Time = time.Now()
+	}
+	// 输入的验证码来自公开请求, 限制长度以免日志被异常内容撑大
+	if len(lookup.Code) > 64 {
+		lookup.Code = lookup.Code[:64]
+	}
+	if len(lookup.UserAgent) > 256 {
+		lookup.UserAgent = lookup.UserAgent[:256]
+	}
+
+	b, err := json.Marshal(lookup)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("写入验证查询日志失败: %v", err)
+	}
+	return nil
+}
+
+func (l *VerifyLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,63 @@
+/**
+  author: kevin
+ */
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+func verifyFlags(flags *pflag.FlagSet) {
+	flags.String("file", "", "export 导出的 JSON 文件")
+	flags.String("cert", "", "学校的证书或签发学校证书的 CA 证书(PEM), 为空时只核验签名与信息一致")
+}
+
+// 离线核验导出信息中的学校签名, 不连接网络
+func runVerify(env *appEnv, flags *pflag.FlagSet) error {
+	file, _ := flags.GetString("file")
+	certFile, _ := flags.GetString("cert")
+	if file == "" {
+		return fmt.Errorf("请通过 --file 指定要核验的文件")
+	}
+
+	edus, err := readEdus(file, "json")
+	if err != nil {
+		return err
+	}
+
+	var trusted []*x509.Certificate
+	if certFile != "" {
+		b, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return fmt.Errorf("读取证书文件失败: %v", err)
+		}
+		trusted, err = service.ParseCertificates(b)
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("未指定学校证书, 只核验签名与信息一致, 不核验签名者身份")
+	}
+
+	var failed int
+	for _, edu := range edus {
+		cert, err := service.VerifyEduSignature(edu, trusted)
+		if err != nil {
+			failed++
+			fmt.Printf("%s 核验失败: %v\n", edu.EntityID, err)
+			continue
+		}
+		fmt.Printf("%s 核验通过, 签名者: %s, 签发者: %s\n", edu.EntityID, cert.Subject.CommonName, cert.Issuer.CommonName)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("共 %d 条信息, %d 条核验失败", len(edus), failed)
+	}
+	fmt.Printf("共 %d 条信息, 全部核验通过\n", len(edus))
+	return nil
+}
@@ -0,0 +1,85 @@
+/**
+  author: kevin
+ */
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+	"github.com/spf13/pflag"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 根据配置创建照片存储, 照片与缩略图的对应关系保存在数据目录中
+func (env *appEnv) attachments() (*service.Attachments, error) {
+	cfg := env.cfg.Storage
+
+	var store service.BlobStore
+	var err error
+	switch cfg.Backend {
+	case "s3":
+		store, err = service.NewS3Store(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.Prefix, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.PathStyle)
+	default:
+		store, err = service.NewLocalStore(cfg.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return service.OpenAttachments(store, filepath.Join(env.cfg.DataDir, "photos.json"))
+}
+
+// 列出账本中未引用的照片文件; 附件记录由 serve 持有并写回, 为避免覆盖其修改,
+// 清理只在 serve 中按 storage.gcInterval 定期执行, 此处不删除文件也不写回附件记录
+func runGC(env *appEnv, flags *pflag.FlagSet) error {
+	serviceSetup, err := env.serviceSetup()
+	if err != nil {
+		return err
+	}
+
+	attachments, err := env.attachments()
+	if err != nil {
+		return err
+	}
+
+	result, err := collectGarbage(serviceSetup, attachments, env.cfg.Storage.GCGrace, true)
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range result.Removed {
+		fmt.Printf("%s %d %s\n", blob.Digest, blob.Size, blob.ModTime.Format(time.RFC3339))
+	}
+	fmt.Printf("将删除 %d 个文件, 保留 %d 个文件\n", len(result.Removed), result.Kept)
+	if env.cfg.Storage.GCInterval > 0 {
+		fmt.Printf("Web 服务每 %v 自动清理一次\n", env.cfg.Storage.GCInterval)
+	} else {
+		fmt.Println("未启用自动清理, 可在 app.yaml 中设置 storage.gcInterval 后由 Web 服务清理")
+	}
+	return nil
+}
+
+// 查询账本中引用的照片后清理, 查询失败时不删除任何文件
+func collectGarbage(setup *service.ServiceSetup, attachments *service.Attachments, grace time.Duration, dryRun bool) (*service.GCResult, error) {
+	refs, err := setup.FindPhotoRefs()
+	if err != nil {
+		return nil, fmt.Errorf("查询账本中引用的照片失败(链码是否已升级?): %v", err)
+	}
+	return attachments.GC(refs, grace, dryRun)
+}
+
+// 定期清理未引用的照片文件
+func collectGarbageEvery(interval time.Duration, setup *service.ServiceSetup, attachments *service.Attachments, grace time.Duration) {
+	for range time.Tick(interval) {
+		result, err := collectGarbage(setup, attachments, grace, false)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(result.Removed) > 0 {
+			fmt.Printf("已清理 %d 个未引用的照片文件\n", len(result.Removed))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 各路由所需的角色, 由 web.WebStart 在启动时通过 Handle 声明
+var routeRoles = make(map[string][]string)
+
+// 注册需登录后访问的路由, roles 为空时所有登录用户均可访问, 否则需具有其中任一角色
+func (app *Application) Handle(pattern string, handler http.HandlerFunc, roles ...string) {
+	routeRoles[pattern] = roles
+	http.HandleFunc(pattern, app.RequireLogin(requireRoles(handler, roles)))
+}
+
+// 授权中间件: 当前用户不具有所需角色时拒绝访问
+func requireRoles(next http.HandlerFunc, roles []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).hasAnyRole(roles) {
+			http.Error(w, "无权访问该页面", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (u User) hasAnyRole(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if u.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户是否可访问指定路由, 供模板隐藏当前用户无权执行的操作
+func (u User) Can(pattern string) bool {
+	roles, ok := routeRoles[pattern]
+	return ok && u.hasAnyRole(roles)
+}
+
+// 登记员只能添加及修改本校的学历信息
+func (u User) CanManage(school string) bool {
+	return u.HasRole(service.RoleRegistrar) && u.School != "" && u.School == school
+}
@@ -0,0 +1,107 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 网络管理: Peer 节点状态、已安装及已实例化的链码、背书策略
+func (app *Application) NetworkView(w http.ResponseWriter, r *http.Request) {
+
+	data := &struct {
+		Network *service.NetworkInfo
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		CurrentUser:currentUser(r),
+		Msg:"",
+		Flag:false,
+	}
+
+	info, err := app.Network.QueryNetwork()
+	if err != nil {
+		data.Msg = err.Error()
+		data.Flag = true
+	}
+	data.Network = info
+
+	ShowView(w, r, "network.html", data)
+}
+
+// Web 账号及其对应的 Fabric 身份
+type accountIdentity struct {
+	User service.Account
+	Identity *service.Identity
+}
+
+// 身份管理: 为 Web 账号登记 Fabric 身份或吊销已有身份
+func (app *Application) IdentitiesView(w http.ResponseWriter, r *http.Request) {
+	app.showIdentities(w, r, "", false)
+}
+
+// 为指定账号在 fabric-ca 中登记并注册身份
+func (app *Application) IdentityEnroll(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	loginName := r.FormValue("loginName")
+	account, ok := app.Users.Get(loginName)
+	if !ok {
+		app.showIdentities(w, r, "账号 "+loginName+" 不存在", true)
+		return
+	}
+
+	id, err := app.Identities.Enroll(loginName, account.School)
+	if err != nil {
+		app.showIdentities(w, r, err.Error(), true)
+		return
+	}
+	app.showIdentities(w, r, "已为账号 "+loginName+" 注册 Fabric 身份 "+id.EnrollID, false)
+}
+
+// 吊销指定账号的 Fabric 身份, 必须填写原因
+func (app *Application) IdentityRevoke(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	loginName := r.FormValue("loginName")
+	note := strings.TrimSpace(r.FormValue("note"))
+	if note == "" {
+		app.showIdentities(w, r, "请填写吊销原因", true)
+		return
+	}
+
+	err := app.Identities.Revoke(loginName, note)
+	if err != nil {
+		app.showIdentities(w, r, err.Error(), true)
+		return
+	}
+	app.showIdentities(w, r, "已吊销账号 "+loginName+" 的 Fabric 身份", false)
+}
+
+func (app *Application) showIdentities(w http.ResponseWriter, r *http.Request, msg string, failed bool) {
+	data := &struct {
+		Accounts []accountIdentity
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		CurrentUser:currentUser(r),
+		Msg:msg,
+		Flag:failed,
+	}
+
+	for _, account := range app.Users.List() {
+		data.Accounts = append(data.Accounts, accountIdentity{User: account, Identity: app.Identities.Identity(account.LoginName)})
+	}
+
+	ShowView(w, r, "identities.html", data)
+}
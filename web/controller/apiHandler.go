@@ -0,0 +1,315 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 请求体的最大长度
+const maxAPIBody = 1 << 20
+
+// 写入操作的响应
+type TxResult struct {
+	TxID	string	`json:"txId"`
+}
+
+// 核验学历时返回的信息, 不含身份证号、出生日期、照片、签名及承诺等
+type EduSummary struct {
+	Name	string
+	SchoolName	string
+	Major	string
+	Level	string
+	CertNo	string
+	Graduation	string
+	Revoked	bool
+	RevokedAt	string	`json:",omitempty"`
+}
+
+// GET /api/v1/educations?certNo=&name=
+// 审计员及本校登记员返回完整信息, 核验员等其他调用方只返回核验所需的信息
+func (app *Application) APIFindEdu(w http.ResponseWriter, r *http.Request) {
+	certNo := r.URL.Query().Get("certNo")
+	name := r.URL.Query().Get("name")
+	if certNo == "" || name == "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "certNo 与 name 均不能为空")
+		return
+	}
+	// 参数会拼入 CouchDB 查询条件, 升级前的链码未对其转义
+	if strings.ContainsAny(certNo+name, "\"\\") {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "certNo 与 name 不能包含引号或反斜杠")
+		return
+	}
+
+	result, err := app.Setup.FindEduByCertNoAndName(certNo, name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	var edu service.Education
+	if err := json.Unmarshal(result, &edu); err != nil {
+		writeAPIError(w, http.StatusBadGateway, "ledger_error", "解析查询结果失败: "+err.Error())
+		return
+	}
+
+	user := currentUser(r)
+	if user.HasRole(service.RoleAuditor) || user.CanManage(edu.SchoolName) {
+		writeJSON(w, http.StatusOK, edu)
+		return
+	}
+	writeJSON(w, http.StatusOK, EduSummary{
+		Name: edu.Name,
+		SchoolName: edu.SchoolName,
+		Major: edu.Major,
+		Level: edu.Level,
+		CertNo: edu.CertNo,
+		Graduation: edu.Graduation,
+		Revoked: edu.Revoked,
+		RevokedAt: edu.RevokedAt,
+	})
+}
+
+// GET /api/v1/educations/{entityID}
+func (app *Application) APIGetEdu(w http.ResponseWriter, r *http.Request) {
+	edu, err := app.loadEdu(pathParam(r, "entityID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	edu.Historys = nil
+	writeJSON(w, http.StatusOK, edu)
+}
+
+// GET /api/v1/educations/{entityID}/history
+func (app *Application) APIEduHistory(w http.ResponseWriter, r *http.Request) {
+	edu, err := app.loadEdu(pathParam(r, "entityID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	app.Setup.EnrichHistory(&edu)
+
+	history := edu.Historys
+	if history == nil {
+		history = []service.HistoryItem{}
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// POST /api/v1/educations
+func (app *Application) APICreateEdu(w http.ResponseWriter, r *http.Request) {
+	edu, ok := readEdu(w, r)
+	if !ok {
+		return
+	}
+
+	user := currentUser(r)
+	if !user.CanManage(edu.SchoolName) {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "只能添加本校的学历信息")
+		return
+	}
+
+	setup, err := app.setupFor(user)
+	if err != nil {
+		writeAPIError(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	}
+
+	key, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	txID, err := setup.SaveEduOnce(key, edu)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/educations/"+url.PathEscape(edu.EntityID))
+	writeJSON(w, http.StatusCreated, TxResult{TxID: txID})
+}
+
+// PUT /api/v1/educations/{entityID}
+func (app *Application) APIUpdateEdu(w http.ResponseWriter, r *http.Request) {
+	entityID := pathParam(r, "entityID")
+	edu, ok := readEdu(w, r)
+	if !ok {
+		return
+	}
+	if edu.EntityID != entityID {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "请求体中的 EntityID 与路径不一致")
+		return
+	}
+
+	setup, ok := app.apiManage(w, r, entityID, edu.SchoolName)
+	if !ok {
+		return
+	}
+
+	key, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	txID, err := setup.ModifyEduOnce(key, edu)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TxResult{TxID: txID})
+}
+
+// DELETE /api/v1/educations/{entityID}: 撤销信息, 请求体中须指定撤销原因; 信息仍保留在账本中并标记为已撤销
+func (app *Application) APIRevokeEdu(w http.ResponseWriter, r *http.Request) {
+	entityID := pathParam(r, "entityID")
+
+	var req struct {
+		Reason	string	`json:"reason"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "请求体须为包含撤销原因的 JSON 对象: "+err.Error())
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "撤销原因不能为空")
+		return
+	}
+
+	edu, err := app.loadEdu(entityID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	user := currentUser(r)
+	if !user.CanManage(edu.SchoolName) {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "只能撤销本校的学历信息")
+		return
+	}
+	if edu.Revoked {
+		writeAPIError(w, http.StatusConflict, "conflict", "该信息已于 "+edu.RevokedAt+" 撤销")
+		return
+	}
+
+	setup, err := app.setupFor(user)
+	if err != nil {
+		writeAPIError(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	}
+
+	key, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	txID, err := setup.RevokeEduOnce(key, entityID, reason)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TxResult{TxID: txID})
+}
+
+// GET /api/v1/openapi.yaml
+func (app *Application) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	http.ServeFile(w, r, filepath.Join(StaticDir, "api", "openapi.yaml"))
+}
+
+// 修改或删除前检查原有信息存在且属于当前用户的学校, newSchool 非空时修改后的信息也须属于本校
+func (app *Application) apiManage(w http.ResponseWriter, r *http.Request, entityID, newSchool string) (*service.ServiceSetup, bool) {
+	old, err := app.loadEdu(entityID)
+	if err != nil {
+		writeServiceError(w, err)
+		return nil, false
+	}
+
+	user := currentUser(r)
+	if !user.CanManage(old.SchoolName) || (newSchool != "" && !user.CanManage(newSchool)) {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "只能修改本校的学历信息")
+		return nil, false
+	}
+
+	setup, err := app.setupFor(user)
+	if err != nil {
+		writeAPIError(w, http.StatusForbidden, "forbidden", err.Error())
+		return nil, false
+	}
+	return setup, true
+}
+
+// 根据身份证号查询信息, 结果中包含链码返回的历史记录
+func (app *Application) loadEdu(entityID string) (service.Education, error) {
+	var edu service.Education
+	result, err := app.Setup.FindEduInfoByEntityID(entityID)
+	if err != nil {
+		return edu, err
+	}
+	err = json.Unmarshal(result, &edu)
+	return edu, err
+}
+
+// 解析请求体中的学历信息
+func readEdu(w http.ResponseWriter, r *http.Request) (service.Education, bool) {
+	var edu service.Education
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&edu); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "请求体不是有效的学历信息: "+err.Error())
+		return edu, false
+	}
+	if edu.EntityID == "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "EntityID 不能为空")
+		return edu, false
+	}
+	edu.Historys = nil
+	return edu, true
+}
+
+// 请求的幂等键: 调用方通过 Idempotency-Key 请求头指定时, 重试相同的请求不会重复写入账本;
+// 未指定时生成新的幂等键
+func idempotencyKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key, err := service.NewIdempotencyKey()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal", err.Error())
+			return "", false
+		}
+		return key, true
+	}
+
+	if len(key) > 128 {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Idempotency-Key 不能超过 128 个字符")
+		return "", false
+	}
+	// 不同调用方的幂等键互不影响
+	return "api:" + currentUser(r).LoginName + ":" + key, true
+}
+
+// 将 ServiceSetup 返回的错误转换为对应的状态码
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case service.IsNotFound(err):
+		writeAPIError(w, http.StatusNotFound, "not_found", service.ErrorMessage(err))
+	case service.IsExists(err):
+		writeAPIError(w, http.StatusConflict, "conflict", service.ErrorMessage(err))
+	case err == service.ErrInFlight:
+		writeAPIError(w, http.StatusConflict, "conflict", err.Error())
+	case err == service.ErrKeyReused:
+		writeAPIError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error())
+	default:
+		writeAPIError(w, http.StatusBadGateway, "ledger_error", service.ErrorMessage(err))
+	}
+}
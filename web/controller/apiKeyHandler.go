@@ -0,0 +1,111 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 访问令牌响应, 格式与 OAuth 2.0 一致
+type TokenResponse struct {
+	AccessToken	string	`json:"access_token"`
+	TokenType	string	`json:"token_type"`
+	ExpiresIn	int64	`json:"expires_in"`
+}
+
+// POST /api/v1/token: 使用 API 密钥(Authorization: ApiKey <密钥>)换取短期访问令牌
+func (app *Application) APIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "不支持的请求方法: "+r.Method)
+		return
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "ApiKey ") {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "请在 Authorization 请求头中提供 API 密钥")
+		return
+	}
+
+	key, err := app.APIKeys.Authenticate(strings.TrimPrefix(auth, "ApiKey "))
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+
+	token, expires, err := app.Tokens.Issue(key)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal", "签发访问令牌失败")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, TokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(time.Until(expires).Round(time.Second).Seconds())})
+}
+
+// API 密钥管理: 创建及吊销供合作方系统使用的密钥
+func (app *Application) APIKeysView(w http.ResponseWriter, r *http.Request) {
+	app.showAPIKeys(w, r, "", "", false)
+}
+
+// 创建 API 密钥, 明文密钥只在创建后显示一次
+func (app *Application) APIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	key, plain, err := app.APIKeys.Create(r.FormValue("name"), r.FormValue("org"), r.FormValue("role"), r.FormValue("school"), currentUser(r).LoginName)
+	if err != nil {
+		app.showAPIKeys(w, r, "", err.Error(), true)
+		return
+	}
+	app.showAPIKeys(w, r, plain, "已为 "+key.Org+" 创建 API 密钥, 请立即复制保存, 关闭页面后将无法再次查看", false)
+}
+
+// 吊销 API 密钥
+func (app *Application) APIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	id := r.FormValue("id")
+	err := app.APIKeys.Revoke(id)
+	if err != nil {
+		app.showAPIKeys(w, r, "", err.Error(), true)
+		return
+	}
+	app.showAPIKeys(w, r, "", "已吊销 API 密钥 "+id, false)
+}
+
+func (app *Application) showAPIKeys(w http.ResponseWriter, r *http.Request, plain, msg string, failed bool) {
+	var roles []string
+	for _, role := range service.Roles {
+		if role != service.RoleAdmin && role != service.RoleHolder {
+			roles = append(roles, role)
+		}
+	}
+
+	data := &struct {
+		Keys []service.APIKey
+		Roles []string
+		NewKey string
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		Keys:app.APIKeys.List(),
+		Roles:roles,
+		NewKey:plain,
+		CurrentUser:currentUser(r),
+		Msg:msg,
+		Flag:failed,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	ShowView(w, r, "apikeys.html", data)
+}
@@ -0,0 +1,168 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// API 的错误响应, 如 {"error": {"status": 404, "code": "not_found", "message": "..."}}
+type APIError struct {
+	Status	int	`json:"status"`
+	Code	string	`json:"code"`
+	Message	string	`json:"message"`
+}
+
+type apiRoute struct {
+	method	string
+	segments	[]string	// 以 {name} 表示路径参数
+	handler	http.HandlerFunc
+	roles	[]string
+}
+
+// REST API 路由: 按请求方法及路径匹配, 每个路由声明所需的角色, 未认证及无权访问时返回 JSON 错误
+type APIRouter struct {
+	app	*Application
+	routes	[]apiRoute
+}
+
+func (app *Application) NewAPIRouter() *APIRouter {
+	return &APIRouter{app: app}
+}
+
+// 注册路由, pattern 如 /api/v1/educations/{entityID}, roles 为空时所有已认证的调用方均可访问
+func (api *APIRouter) Handle(method, pattern string, handler http.HandlerFunc, roles ...string) {
+	api.routes = append(api.routes, apiRoute{method: method, segments: splitPath(pattern), handler: handler, roles: roles})
+}
+
+func (api *APIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+
+	var allowed []string
+	for _, route := range api.routes {
+		params, ok := matchPath(route.segments, segments)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+
+		user, err := api.app.apiUser(r)
+		if err != nil {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		if !user.hasAnyRole(route.roles) {
+			writeAPIError(w, http.StatusForbidden, "forbidden", "无权执行该操作")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey, user)
+		ctx = context.WithValue(ctx, paramsKey, params)
+		route.handler(w, r.WithContext(ctx))
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "不支持的请求方法: "+r.Method)
+		return
+	}
+	writeAPIError(w, http.StatusNotFound, "not_found", "接口不存在: "+r.URL.Path)
+}
+
+// 确定 API 调用方: 依次支持 Bearer 访问令牌、API 密钥及浏览器会话
+func (app *Application) apiUser(r *http.Request) (User, error) {
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "Bearer "):
+		claims, err := app.Tokens.Verify(strings.TrimPrefix(auth, "Bearer "))
+		if err != nil {
+			return User{}, err
+		}
+		key, err := app.APIKeys.Use(claims.Subject)
+		if err != nil {
+			return User{}, err
+		}
+		return keyUser(key), nil
+
+	case strings.HasPrefix(auth, "ApiKey "):
+		key, err := app.APIKeys.Authenticate(strings.TrimPrefix(auth, "ApiKey "))
+		if err != nil {
+			return User{}, err
+		}
+		return keyUser(key), nil
+
+	case auth != "":
+		return User{}, errors.New("不支持的认证方式, 请使用 Bearer 或 ApiKey")
+	}
+
+	loginName, ok := app.Sessions.Get(r)
+	if !ok {
+		return User{}, errors.New("未登录或会话已失效")
+	}
+	user, ok := app.findUser(loginName)
+	if !ok {
+		return User{}, errors.New("未登录或会话已失效")
+	}
+	return user, nil
+}
+
+// 以 API 密钥调用时的用户, 角色及学校与密钥一致
+func keyUser(key service.APIKey) User {
+	return User{LoginName: "apikey:" + key.ID, Roles: []string{key.Role}, School: key.School}
+}
+
+const paramsKey contextKey = 1
+
+// 路径参数, 如 /api/v1/educations/{entityID} 中的 entityID
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func matchPath(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[p[1:len(p)-1]] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, struct {
+		Error APIError `json:"error"`
+	}{APIError{Status: status, Code: code, Message: message}})
+}
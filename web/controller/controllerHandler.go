@@ -13,24 +13,32 @@ import (
 	"encoding/json"
 	"github.com/kongyixueyuan.com/education/service"
 	"fmt"
+	"strings"
 )
 
-var cuser User
-
 func (app *Application) LoginView(w http.ResponseWriter, r *http.Request)  {
+	if app.Users.Empty() {
+		http.Redirect(w, r, "/setup", http.StatusFound)
+		return
+	}
 
 	ShowView(w, r, "login.html", nil)
 }
 
 func (app *Application) Index(w http.ResponseWriter, r *http.Request)  {
-	ShowView(w, r, "index.html", nil)
+	data := &struct {
+		CurrentUser User
+	}{
+		CurrentUser:currentUser(r),
+	}
+	ShowView(w, r, "index.html", data)
 }
 
 func (app *Application) Help(w http.ResponseWriter, r *http.Request)  {
 	data := &struct {
 		CurrentUser User
 	}{
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 	}
 	ShowView(w, r, "help.html", data)
 }
@@ -40,100 +48,92 @@ func (app *Application) Login(w http.ResponseWriter, r *http.Request) {
 	loginName := r.FormValue("loginName")
 	password := r.FormValue("password")
 
-	var flag bool
-	for _, user := range users {
-		if user.LoginName == loginName && user.Password == password {
-			cuser = user
-			flag = true
-			break
+	account, err := app.Users.Authenticate(loginName, password)
+	if err == nil {
+		// 登录成功
+		err = app.Sessions.Create(w, account.LoginName)
+		if err != nil {
+			http.Error(w, "创建会话失败", http.StatusInternalServerError)
+			return
 		}
+		http.Redirect(w, r, "/index", http.StatusFound)
+		return
 	}
 
+	// 登录失败
 	data := &struct {
 		CurrentUser User
 		Flag bool
 	}{
-		CurrentUser:cuser,
-		Flag:false,
-	}
-
-	if flag {
-		// 登录成功
-		ShowView(w, r, "index.html", data)
-	}else{
-		// 登录失败
-		data.Flag = true
-		data.CurrentUser.LoginName = loginName
-		ShowView(w, r, "login.html", data)
+		CurrentUser:User{LoginName:loginName},
+		Flag:true,
 	}
+	ShowView(w, r, "login.html", data)
 }
 
 // 用户登出
 func (app *Application) LoginOut(w http.ResponseWriter, r *http.Request)  {
-	cuser = User{}
+	app.Sessions.Destroy(w, r)
 	ShowView(w, r, "login.html", nil)
 }
 
-// 显示添加信息页面
+// 显示添加信息页面, 指定了提交失败的任务时以任务中的信息填充表单
 func (app *Application) AddEduShow(w http.ResponseWriter, r *http.Request)  {
 	data := &struct {
+		Edu service.Education
 		CurrentUser User
 		Msg string
 		Flag bool
 	}{
-		CurrentUser:cuser,
+		Edu:service.Education{SchoolName:currentUser(r).School},
+		CurrentUser:currentUser(r),
 		Msg:"",
 		Flag:false,
 	}
+
+	if job, ok := app.failedJob(r, "addEdu"); ok {
+		data.Edu = job.Edu
+		data.Msg = "信息添加失败: " + job.Error
+		data.Flag = true
+	}
+
 	ShowView(w, r, "addEdu.html", data)
 }
 
-// 添加信息
+// 添加信息: 加入提交任务队列后跳转至任务状态页面
 func (app *Application) AddEdu(w http.ResponseWriter, r *http.Request)  {
+	edu := formEdu(r)
 
-	edu := service.Education{
-		Name:r.FormValue("name"),
-		Gender:r.FormValue("gender"),
-		Nation:r.FormValue("nation"),
-		EntityID:r.FormValue("entityID"),
-		Place:r.FormValue("place"),
-		BirthDay:r.FormValue("birthDay"),
-		EnrollDate:r.FormValue("enrollDate"),
-		GraduationDate:r.FormValue("graduationDate"),
-		SchoolName:r.FormValue("schoolName"),
-		Major:r.FormValue("major"),
-		QuaType:r.FormValue("quaType"),
-		Length:r.FormValue("length"),
-		Mode:r.FormValue("mode"),
-		Level:r.FormValue("level"),
-		Graduation:r.FormValue("graduation"),
-		CertNo:r.FormValue("certNo"),
-		Photo:r.FormValue("photo"),
+	user := currentUser(r)
+	if !user.CanManage(edu.SchoolName) {
+		http.Error(w, "只能添加本校的学历信息", http.StatusForbidden)
+		return
 	}
 
-	app.Setup.SaveEdu(edu)
-	/*transactionID, err := app.Setup.SaveEdu(edu)
-
-	data := &struct {
-		CurrentUser User
-		Msg string
-		Flag bool
-	}{
-		CurrentUser:cuser,
-		Flag:true,
-		Msg:"",
+	if _, err := app.setupFor(user); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
 	}
 
+	job, err := app.Jobs.Submit(user.LoginName, "addEdu", edu)
 	if err != nil {
-		data.Msg = err.Error()
-	}else{
-		data.Msg = "信息添加成功:" + transactionID
-	}*/
-
-	//ShowView(w, r, "addEdu.html", data)
-	r.Form.Set("certNo", edu.CertNo)
-	r.Form.Set("name", edu.Name)
-	app.FindCertByNoAndName(w, r)
+		// 保留已填写的信息, 以便重新提交
+		data := &struct {
+			Edu service.Education
+			CurrentUser User
+			Msg string
+			Flag bool
+		}{
+			Edu:edu,
+			CurrentUser:user,
+			Msg:"信息添加失败: " + err.Error(),
+			Flag:true,
+		}
+		ShowView(w, r, "addEdu.html", data)
+		return
+	}
+
+	http.Redirect(w, r, "/jobs/"+job.ID, http.StatusSeeOther)
 }
 
 func (app *Application) QueryPage(w http.ResponseWriter, r *http.Request)  {
@@ -142,7 +142,7 @@ func (app *Application) QueryPage(w http.ResponseWriter, r *http.Request)  {
 		Msg string
 		Flag bool
 	}{
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 		Msg:"",
 		Flag:false,
 	}
@@ -168,7 +168,7 @@ func (app *Application) FindCertByNoAndName(w http.ResponseWriter, r *http.Reque
 		History bool
 	}{
 		Edu:edu,
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 		Msg:"",
 		Flag:false,
 		History:false,
@@ -188,7 +188,7 @@ func (app *Application) QueryPage2(w http.ResponseWriter, r *http.Request)  {
 		Msg string
 		Flag bool
 	}{
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 		Msg:"",
 		Flag:false,
 	}
@@ -201,6 +201,9 @@ func (app *Application) FindByID(w http.ResponseWriter, r *http.Request)  {
 	result, err := app.Setup.FindEduInfoByEntityID(entityID)
 	var edu = service.Education{}
 	json.Unmarshal(result, &edu)
+	if err == nil {
+		app.Setup.EnrichHistory(&edu)
+	}
 
 	data := &struct {
 		Edu service.Education
@@ -210,7 +213,7 @@ func (app *Application) FindByID(w http.ResponseWriter, r *http.Request)  {
 		History bool
 	}{
 		Edu:edu,
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 		Msg:"",
 		Flag:false,
 		History:true,
@@ -224,8 +227,24 @@ func (app *Application) FindByID(w http.ResponseWriter, r *http.Request)  {
 	ShowView(w, r, "queryResult.html", data)
 }
 
-// 修改/添加新信息
+// 修改/添加新信息, 指定了提交失败的任务时以任务中的信息填充表单
 func (app *Application) ModifyShow(w http.ResponseWriter, r *http.Request)  {
+	if job, ok := app.failedJob(r, "updateEdu"); ok {
+		data := &struct {
+			Edu service.Education
+			CurrentUser User
+			Msg string
+			Flag bool
+		}{
+			Edu:job.Edu,
+			CurrentUser:currentUser(r),
+			Flag:true,
+			Msg:"信息修改失败: " + job.Error,
+		}
+		ShowView(w, r, "modify.html", data)
+		return
+	}
+
 	// 根据证书编号与姓名查询信息
 	certNo := r.FormValue("certNo")
 	name := r.FormValue("name")
@@ -234,6 +253,14 @@ func (app *Application) ModifyShow(w http.ResponseWriter, r *http.Request)  {
 	var edu = service.Education{}
 	json.Unmarshal(result, &edu)
 
+	if err == nil && !currentUser(r).CanManage(edu.SchoolName) {
+		http.Error(w, "只能修改本校的学历信息", http.StatusForbidden)
+		return
+	}
+	if err == nil && edu.Revoked {
+		err = fmt.Errorf("该信息已于 %s 撤销, 不能修改", edu.RevokedAt)
+	}
+
 	data := &struct {
 		Edu service.Education
 		CurrentUser User
@@ -241,7 +268,7 @@ func (app *Application) ModifyShow(w http.ResponseWriter, r *http.Request)  {
 		Flag bool
 	}{
 		Edu:edu,
-		CurrentUser:cuser,
+		CurrentUser:currentUser(r),
 		Flag:true,
 		Msg:"",
 	}
@@ -254,9 +281,55 @@ func (app *Application) ModifyShow(w http.ResponseWriter, r *http.Request)  {
 	ShowView(w, r, "modify.html", data)
 }
 
-// 修改/添加新信息
+// 修改信息: 加入提交任务队列后跳转至任务状态页面
 func (app *Application) Modify(w http.ResponseWriter, r *http.Request) {
-	edu := service.Education{
+	edu := formEdu(r)
+
+	// 原有信息及修改后的信息均须属于本校
+	user := currentUser(r)
+	var old = service.Education{}
+	result, err := app.Setup.FindEduInfoByEntityID(edu.EntityID)
+	if err == nil {
+		err = json.Unmarshal(result, &old)
+	}
+	if err != nil || !user.CanManage(old.SchoolName) || !user.CanManage(edu.SchoolName) {
+		http.Error(w, "只能修改本校的学历信息", http.StatusForbidden)
+		return
+	}
+	if old.Revoked {
+		http.Error(w, "该信息已撤销, 不能修改", http.StatusConflict)
+		return
+	}
+
+	if _, err := app.setupFor(user); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	job, err := app.Jobs.Submit(user.LoginName, "updateEdu", edu)
+	if err != nil {
+		// 保留已填写的信息, 以便重新提交
+		data := &struct {
+			Edu service.Education
+			CurrentUser User
+			Msg string
+			Flag bool
+		}{
+			Edu:edu,
+			CurrentUser:user,
+			Msg:"信息修改失败: " + err.Error(),
+			Flag:true,
+		}
+		ShowView(w, r, "modify.html", data)
+		return
+	}
+
+	http.Redirect(w, r, "/jobs/"+job.ID, http.StatusSeeOther)
+}
+
+// 根据表单内容构造学历信息
+func formEdu(r *http.Request) service.Education {
+	return service.Education{
 		Name:r.FormValue("name"),
 		Gender:r.FormValue("gender"),
 		Nation:r.FormValue("nation"),
@@ -275,31 +348,55 @@ func (app *Application) Modify(w http.ResponseWriter, r *http.Request) {
 		CertNo:r.FormValue("certNo"),
 		Photo:r.FormValue("photo"),
 	}
+}
 
-	//transactionID, err := app.Setup.ModifyEdu(edu)
-	app.Setup.ModifyEdu(edu)
+// 根据交易编号查看交易详情, 交易涉及的信息不属于本校时参数中的个人信息脱敏显示
+func (app *Application) TxDetail(w http.ResponseWriter, r *http.Request) {
+	txID := strings.TrimPrefix(r.URL.Path, "/tx/")
+	info, err := app.Setup.FindTxInfo(txID)
+	if err == nil && !currentUser(r).CanManage(app.txSchool(info)) {
+		service.MaskTxArgs(info)
+	}
+	showTx(w, r, info, err)
+}
 
-	/*data := &struct {
-		Edu service.Education
+// 交易涉及的信息所属的学校: 添加及修改时取自参数中的信息, 撤销及删除时查询账本中的当前信息
+func (app *Application) txSchool(info *service.TxInfo) string {
+	if len(info.Args) == 0 {
+		return ""
+	}
+	switch info.Function {
+	case "addEdu", "updateEdu":
+		var edu service.Education
+		if json.Unmarshal([]byte(info.Args[0]), &edu) == nil {
+			return edu.SchoolName
+		}
+	case "revokeEdu", "delEdu":
+		if edu, err := app.loadEdu(info.Args[0]); err == nil {
+			return edu.SchoolName
+		}
+	}
+	return ""
+}
+
+// 显示交易详情页面
+func showTx(w http.ResponseWriter, r *http.Request, info *service.TxInfo, err error) {
+	data := &struct {
+		Tx *service.TxInfo
 		CurrentUser User
 		Msg string
 		Flag bool
 	}{
-		CurrentUser:cuser,
-		Flag:true,
+		Tx:info,
+		CurrentUser:currentUser(r),
 		Msg:"",
+		Flag:false,
 	}
 
 	if err != nil {
 		data.Msg = err.Error()
-	}else{
-		data.Msg = "新信息添加成功:" + transactionID
+		data.Flag = true
 	}
 
-	ShowView(w, r, "modify.html", data)
-	*/
-
-	r.Form.Set("certNo", edu.CertNo)
-	r.Form.Set("name", edu.Name)
-	app.FindCertByNoAndName(w, r)
+	ShowView(w, r, "tx.html", data)
 }
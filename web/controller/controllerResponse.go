@@ -11,10 +11,16 @@ import (
 	"fmt"
 )
 
+// 模板及静态文件所在目录, 由 web.WebStart 根据配置设置
+var (
+	TplDir = filepath.Join("web", "tpl")
+	StaticDir = filepath.Join("web", "static")
+)
+
 func ShowView(w http.ResponseWriter, r *http.Request, templateName string, data interface{})  {
 
 	// 指定视图所在路径
-	pagePath := filepath.Join("web", "tpl", templateName)
+	pagePath := filepath.Join(TplDir, templateName)
 
 	resultTemplate, err := template.ParseFiles(pagePath)
 	if err != nil {
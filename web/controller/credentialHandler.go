@@ -0,0 +1,144 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 可验证凭证的大小上限
+const maxCredentialSize = 64 << 10
+
+// 核验可验证凭证的结果
+type CredentialResult struct {
+	Status	string	`json:"status"`	// active 或 revoked
+	Issuer	string	`json:"issuer"`	// 凭证中的签发者标识
+	Signer	string	`json:"signer"`	// 签名证书的 CN
+	TxID	string	`json:"txID"`	// 签发凭证时信息所在的交易
+	Superseded	bool	`json:"superseded,omitempty"`	// 信息此后已被修改, 凭证中的为当时的版本
+	RevokedAt	string	`json:"revokedAt,omitempty"`
+}
+
+// 持证人下载本人学历信息的可验证凭证
+func (app *Application) HolderCredential(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	edu, err := app.findEdu(currentUser(r).EntityID)
+	var vc service.Credential
+	if err == nil {
+		vc, err = app.issueCredential(edu)
+	}
+	if err != nil {
+		app.showHolder(w, r, "", "生成可验证凭证失败: "+service.ErrorMessage(err), true)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="credential.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, vc)
+}
+
+// GET /api/v1/educations/{entityID}/credential
+func (app *Application) APIEduCredential(w http.ResponseWriter, r *http.Request) {
+	edu, err := app.loadEdu(pathParam(r, "entityID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	vc, err := app.issueCredential(edu)
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, "conflict", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, vc)
+}
+
+// 为信息的当前版本签发凭证, 已撤销的信息不能签发
+func (app *Application) issueCredential(edu service.Education) (service.Credential, error) {
+	if edu.Revoked {
+		return service.Credential{}, errors.New("该信息已撤销, 不能签发凭证")
+	}
+	if len(edu.Historys) == 0 {
+		return service.Credential{}, errors.New("未查询到信息对应的交易")
+	}
+	return app.Credentials.Issue(edu, edu.Historys[len(edu.Historys)-1].TxId)
+}
+
+// POST /api/v1/credentials/verify: 核验可验证凭证的签名, 并在账本中核对信息及其当前状态, 无需认证
+func (app *Application) CredentialVerifyAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "不支持的请求方法: "+r.Method)
+		return
+	}
+
+	var vc service.Credential
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCredentialSize)).Decode(&vc); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "解析凭证失败: "+err.Error())
+		return
+	}
+
+	result, err := app.verifyCredential(w, r, vc)
+	if err != nil {
+		e := err.(*verifyError)
+		writeAPIError(w, e.status, e.code, e.msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// 先核验凭证的 proof, 再在账本中核对签发时的信息版本并查询信息的当前状态
+func (app *Application) verifyCredential(w http.ResponseWriter, r *http.Request, vc service.Credential) (CredentialResult, error) {
+	lookup := service.VerifyLookup{Via: "credential-api", Code: vc.ID}
+	defer app.recordLookup(&lookup)
+	if err := app.allowLookup(w, r, &lookup); err != nil {
+		return CredentialResult{}, err
+	}
+
+	cert, err := app.Credentials.Verify(vc)
+	if err != nil {
+		lookup.Result = "invalid"
+		return CredentialResult{}, &verifyError{http.StatusUnprocessableEntity, "invalid_credential", "凭证无效: " + err.Error()}
+	}
+	lookup.EntityID = vc.CredentialSubject.Identifier
+
+	state, err := app.Setup.CheckCredential(vc)
+	if service.IsNotFound(err) {
+		lookup.Result = "not_found"
+		return CredentialResult{}, &verifyError{http.StatusNotFound, "not_found", "账本中没有该凭证对应的学历信息"}
+	}
+	if err == service.ErrCredentialMismatch {
+		lookup.Result = "invalid"
+		return CredentialResult{}, &verifyError{http.StatusUnprocessableEntity, "invalid_credential", "凭证无效: " + err.Error()}
+	}
+	if err != nil {
+		lookup.Result = "error"
+		log.Println("核验凭证时查询账本失败: " + err.Error())
+		return CredentialResult{}, &verifyError{http.StatusBadGateway, "ledger_error", "查询账本失败, 请稍后再试"}
+	}
+
+	result := CredentialResult{
+		Status: verifyActive,
+		Issuer: vc.Issuer.ID,
+		Signer: cert.Subject.CommonName,
+		TxID: vc.CredentialStatus.TxID,
+		Superseded: !state.Current,
+	}
+	if state.Revoked {
+		result.Status = verifyRevoked
+		result.RevokedAt = state.RevokedAt
+	}
+
+	lookup.Result = result.Status
+	return result, nil
+}
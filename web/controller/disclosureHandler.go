@@ -0,0 +1,148 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 披露包的大小上限
+const maxDisclosureSize = 64 << 10
+
+// 核验披露包的结果, 只包含持证人公开的字段
+type DisclosureResult struct {
+	Status	string	`json:"status"`	// active 或 revoked
+	Fields	[]DisclosedField	`json:"fields"`
+	TxID	string	`json:"txID"`	// 生成该组承诺的交易
+	Superseded	bool	`json:"superseded,omitempty"`	// 信息此后已被修改, 公开的为当时的版本
+	RevokedAt	string	`json:"revokedAt,omitempty"`
+}
+
+// 持证人下载只包含所选字段的披露包, 可交给核验方离线或在线核验
+func (app *Application) HolderDisclosure(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	user := currentUser(r)
+	edu, err := app.findEdu(user.EntityID)
+	var d service.Disclosure
+	if err == nil {
+		r.ParseForm()
+		d, err = service.NewDisclosure(edu, app.Setup.SaltKey, r.Form["fields"])
+	}
+	if err != nil {
+		app.showHolder(w, r, "", "生成披露包失败: "+service.ErrorMessage(err), true)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="disclosure.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, d)
+}
+
+// POST /api/v1/disclosures/verify: 核验持证人出示的披露包, 无需认证
+func (app *Application) DisclosureAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "不支持的请求方法: "+r.Method)
+		return
+	}
+
+	var d service.Disclosure
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDisclosureSize)).Decode(&d); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "解析披露包失败: "+err.Error())
+		return
+	}
+
+	result, err := app.verifyDisclosure(w, r, d, "disclosure-api")
+	if err != nil {
+		e := err.(*verifyError)
+		writeAPIError(w, e.status, e.code, e.msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GET /verify/disclosure 粘贴披露包; POST 显示核验结果
+func (app *Application) DisclosurePage(w http.ResponseWriter, r *http.Request) {
+	data := &struct {
+		Package string
+		Result *DisclosureResult
+		Msg string
+		Flag bool
+	}{}
+
+	if r.Method != http.MethodPost {
+		ShowView(w, r, "disclosure.html", data)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDisclosureSize)
+	data.Package = r.FormValue("package")
+
+	var d service.Disclosure
+	err := json.Unmarshal([]byte(data.Package), &d)
+	if err != nil {
+		data.Msg = "解析披露包失败, 请粘贴持证人提供的完整 JSON"
+		data.Flag = true
+		ShowView(w, r, "disclosure.html", data)
+		return
+	}
+
+	result, err := app.verifyDisclosure(w, r, d, "disclosure-page")
+	if err != nil {
+		w.WriteHeader(err.(*verifyError).status)
+		data.Msg = err.Error()
+		data.Flag = true
+	} else {
+		data.Result = &result
+	}
+	ShowView(w, r, "disclosure.html", data)
+}
+
+// 先离线核验披露包自身, 再在账本中查询承诺摘要, 确认承诺确由学校写入及信息的当前状态
+func (app *Application) verifyDisclosure(w http.ResponseWriter, r *http.Request, d service.Disclosure, via string) (DisclosureResult, error) {
+	lookup := service.VerifyLookup{Via: via, Code: d.Root}
+	defer app.recordLookup(&lookup)
+	if err := app.allowLookup(w, r, &lookup); err != nil {
+		return DisclosureResult{}, err
+	}
+
+	if err := d.Verify(); err != nil {
+		lookup.Result = "invalid"
+		return DisclosureResult{}, &verifyError{http.StatusUnprocessableEntity, "invalid_disclosure", "披露包无效: " + err.Error()}
+	}
+
+	record, err := app.Setup.FindCommitments(d.Root)
+	if service.IsNotFound(err) {
+		lookup.Result = "not_found"
+		return DisclosureResult{}, &verifyError{http.StatusNotFound, "not_found", "账本中没有该披露包对应的学历信息"}
+	}
+	if err != nil {
+		lookup.Result = "error"
+		log.Println("核验披露包时查询账本失败: " + err.Error())
+		return DisclosureResult{}, &verifyError{http.StatusBadGateway, "ledger_error", "查询账本失败, 请稍后再试"}
+	}
+	if service.CommitmentRoot(record.Commitments) != d.Root {
+		lookup.Result = "invalid"
+		return DisclosureResult{}, &verifyError{http.StatusUnprocessableEntity, "invalid_disclosure", "披露包无效: 与账本中的承诺不一致"}
+	}
+
+	result := DisclosureResult{Status: verifyActive, TxID: record.TxID, Superseded: !record.Current}
+	if record.Revoked {
+		result.Status = verifyRevoked
+		result.RevokedAt = record.RevokedAt
+	}
+	for _, f := range d.Fields {
+		result.Fields = append(result.Fields, DisclosedField{Name: f.Name, Label: service.FieldLabel(f.Name), Value: f.Value})
+	}
+
+	lookup.Result = result.Status
+	return result, nil
+}
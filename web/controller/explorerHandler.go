@@ -0,0 +1,104 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 区块浏览默认及最多显示的区块数量
+const (
+	defaultBlockCount = 10
+	maxBlockCount = 50
+)
+
+// 区块浏览首页: 链高度及最新的区块
+func (app *Application) Explorer(w http.ResponseWriter, r *http.Request) {
+	count := defaultBlockCount
+	if n, err := strconv.Atoi(r.FormValue("n")); err == nil && n > 0 {
+		count = n
+	}
+	if count > maxBlockCount {
+		count = maxBlockCount
+	}
+
+	data := &struct {
+		Chain *service.ChainInfo
+		Blocks []*service.BlockInfo
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		CurrentUser:currentUser(r),
+		Msg:"",
+		Flag:false,
+	}
+
+	chain, err := app.Setup.QueryChainInfo()
+	if err == nil {
+		data.Chain = chain
+		data.Blocks, err = app.Setup.FindLatestBlocks(count)
+	}
+	if err != nil {
+		data.Msg = err.Error()
+		data.Flag = true
+	}
+
+	ShowView(w, r, "explorer.html", data)
+}
+
+// 区块详情: 区块中每个交易的链码函数、参数(已脱敏)及验证结果
+func (app *Application) ExplorerBlock(w http.ResponseWriter, r *http.Request) {
+	data := &struct {
+		Block *service.BlockInfo
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		CurrentUser:currentUser(r),
+		Msg:"",
+		Flag:false,
+	}
+
+	number, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/explorer/block/"), 10, 64)
+	if err != nil {
+		data.Msg = "无效的区块号"
+		data.Flag = true
+	} else {
+		data.Block, err = app.Setup.FindBlock(number)
+		if err != nil {
+			data.Msg = err.Error()
+			data.Flag = true
+		}
+	}
+
+	ShowView(w, r, "block.html", data)
+}
+
+// 根据交易编号或区块号搜索
+func (app *Application) ExplorerSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.FormValue("q"))
+	if q == "" {
+		http.Redirect(w, r, "/explorer", http.StatusFound)
+		return
+	}
+
+	// 纯数字视为区块号, 否则视为交易编号
+	if _, err := strconv.ParseUint(q, 10, 64); err == nil {
+		http.Redirect(w, r, "/explorer/block/"+q, http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/explorer/tx/"+q, http.StatusFound)
+}
+
+// 区块浏览中的交易详情, 交易参数中的个人信息已脱敏
+func (app *Application) ExplorerTx(w http.ResponseWriter, r *http.Request) {
+	txID := strings.TrimPrefix(r.URL.Path, "/explorer/tx/")
+	info, err := app.Setup.FindMaskedTxInfo(txID)
+	showTx(w, r, info, err)
+}
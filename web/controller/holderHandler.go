@@ -0,0 +1,151 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 持证人可选的验证码有效期
+var shareDurations = []struct {
+	Value	string
+	Label	string
+}{
+	{"24h", "1 天"},
+	{"168h", "7 天"},
+	{"720h", "30 天"},
+}
+
+// 生成验证码时默认公开的字段
+var defaultShareFields = []string{"Name", "Level", "Major", "Graduation", "GraduationDate", "CertNo"}
+
+// 持证人查看本人的学历信息, 生成及作废在线验证码
+func (app *Application) HolderView(w http.ResponseWriter, r *http.Request) {
+	app.showHolder(w, r, r.FormValue("code"), "", false)
+}
+
+// 持证人选择公开的字段及有效期生成验证码
+func (app *Application) HolderShare(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	user := currentUser(r)
+	edu, err := app.findEdu(user.EntityID)
+	if err == nil && edu.Revoked {
+		err = errors.New("该信息已撤销, 不能生成验证码")
+	}
+	if err == nil && len(edu.Historys) == 0 {
+		err = errors.New("未查询到信息对应的交易")
+	}
+
+	var v service.Verification
+	if err == nil {
+		r.ParseForm()
+		ttl, _ := time.ParseDuration(r.FormValue("ttl"))
+		v, err = app.Verifications.Create(edu, edu.Historys[len(edu.Historys)-1].TxId, user.LoginName, r.Form["fields"], ttl)
+	}
+	if err != nil {
+		app.showHolder(w, r, "", "生成验证码失败: "+err.Error(), true)
+		return
+	}
+
+	http.Redirect(w, r, "/my?code="+v.Code, http.StatusSeeOther)
+}
+
+// 持证人提前作废验证码, 作废后验证页面不再显示任何信息
+func (app *Application) HolderWithdraw(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	code := r.FormValue("code")
+	if err := app.Verifications.Withdraw(code, currentUser(r).EntityID); err != nil {
+		app.showHolder(w, r, "", err.Error(), true)
+		return
+	}
+	app.showHolder(w, r, "", "已作废验证码 "+code, false)
+}
+
+type holderCode struct {
+	service.Verification
+	URL	string
+}
+
+// 公开字段的中文名称, 以顿号分隔
+func (c holderCode) Disclosed() string {
+	labels := make([]string, len(c.Fields))
+	for i, name := range c.Fields {
+		labels[i] = service.FieldLabel(name)
+	}
+	return strings.Join(labels, "、")
+}
+
+func (app *Application) showHolder(w http.ResponseWriter, r *http.Request, newCode, msg string, failed bool) {
+	user := currentUser(r)
+	data := &struct {
+		Edu *service.Education
+		Codes []holderCode
+		New *holderCode
+		QRCode template.HTML
+		Fields []service.EduField
+		CommitFields []service.EduField
+		Selected map[string]bool
+		Durations []struct {
+			Value string
+			Label string
+		}
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		Fields:service.DisclosableFields,
+		Selected:make(map[string]bool),
+		CurrentUser:user,
+		Msg:msg,
+		Flag:failed,
+	}
+	for _, name := range defaultShareFields {
+		data.Selected[name] = true
+	}
+	for _, name := range service.CommitFields {
+		data.CommitFields = append(data.CommitFields, service.EduField{Name: name, Label: service.FieldLabel(name)})
+	}
+	for _, d := range shareDurations {
+		if ttl, _ := time.ParseDuration(d.Value); ttl <= app.Verifications.TTL {
+			data.Durations = append(data.Durations, d)
+		}
+	}
+
+	edu, err := app.findEdu(user.EntityID)
+	if err != nil && !failed {
+		data.Msg = "未查询到本人的学历信息: " + service.ErrorMessage(err)
+		data.Flag = true
+	}
+	if err == nil {
+		edu.Historys = nil
+		data.Edu = &edu
+	}
+
+	for _, v := range app.Verifications.List(user.EntityID) {
+		c := holderCode{Verification: v, URL: app.verifyURL(r, v.Code)}
+		data.Codes = append(data.Codes, c)
+		if newCode != "" && v.Code == newCode {
+			data.New = &c
+		}
+	}
+	if data.New != nil {
+		if qr, err := service.EncodeQR(data.New.URL); err == nil {
+			data.QRCode = template.HTML(qr.SVG(3))
+		}
+	}
+
+	ShowView(w, r, "holder.html", data)
+}
@@ -0,0 +1,73 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 当前用户提交的任务列表
+func (app *Application) JobsView(w http.ResponseWriter, r *http.Request) {
+	data := &struct {
+		Jobs []service.Job
+		CurrentUser User
+	}{
+		Jobs:app.Jobs.List(currentUser(r).LoginName),
+		CurrentUser:currentUser(r),
+	}
+	ShowView(w, r, "jobs.html", data)
+}
+
+// 任务状态, 交易提交后显示交易编号、所在区块及提交时间
+func (app *Application) JobDetail(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	job, ok := app.Jobs.Get(id)
+	if !ok || job.Owner != currentUser(r).LoginName {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := &struct {
+		Job service.Job
+		Tx *service.TxInfo
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		Job:job,
+		CurrentUser:currentUser(r),
+		Msg:"",
+		Flag:false,
+	}
+
+	if job.Status == service.JobCommitted {
+		// 交易已提交, 区块信息查询失败时仍显示交易编号
+		info, err := app.Setup.FindTxInfo(job.TxID)
+		if err != nil {
+			data.Msg = "暂时无法查询交易所在的区块: " + err.Error()
+			data.Flag = true
+		} else {
+			data.Tx = info
+		}
+	}
+
+	ShowView(w, r, "job.html", data)
+}
+
+// 根据请求中的 job 参数查找当前用户提交失败的任务, 用于在表单中恢复提交的信息
+func (app *Application) failedJob(r *http.Request, fcn string) (service.Job, bool) {
+	id := r.FormValue("job")
+	if id == "" {
+		return service.Job{}, false
+	}
+
+	job, ok := app.Jobs.Get(id)
+	if !ok || job.Owner != currentUser(r).LoginName || job.Fcn != fcn || job.Status != service.JobFailed {
+		return service.Job{}, false
+	}
+	return job, true
+}
@@ -0,0 +1,101 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// GET /photos/<摘要>: 照片及缩略图只对登录后具有相应角色的用户开放
+func (app *Application) PhotoView(w http.ResponseWriter, r *http.Request) {
+	digest, ok := service.PhotoDigest(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	rc, err := app.Attachments.Store.Open(digest)
+	if err == service.ErrBlobNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		http.Error(w, "读取照片失败", http.StatusBadGateway)
+		return
+	}
+
+	// 内容由摘要确定, 不会变化, 可由浏览器长期缓存, 但不能由共享缓存保存
+	w.Header().Set("ETag", `"`+digest+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	servePhoto(w, r, data, time.Time{})
+}
+
+// 旧版本上传至静态文件目录的照片, 同样只对登录用户开放
+func (app *Application) LegacyPhotoView(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/photo/")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := filepath.Join(StaticDir, "photo", name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	servePhoto(w, r, data, modTime)
+}
+
+// 读取信息中的照片, url 为 /photos/<摘要> 或旧版本的 /static/photo/<文件名>
+func (app *Application) loadPhoto(url string) ([]byte, error) {
+	if digest, ok := service.PhotoDigest(url); ok {
+		rc, err := app.Attachments.Store.Open(digest)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	name := strings.TrimPrefix(url, "/static/photo/")
+	if name == url || name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, service.ErrBlobNotFound
+	}
+	return ioutil.ReadFile(filepath.Join(StaticDir, "photo", name))
+}
+
+// 只以图片类型返回, 避免上传的内容被当作网页等其他类型解析
+func servePhoto(w http.ResponseWriter, r *http.Request, data []byte, modTime time.Time) {
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
@@ -0,0 +1,86 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 令牌桶: 每个客户端最多连续请求 Burst 次, 此后每 Per/Burst 恢复一次
+type bucket struct {
+	tokens	float64
+	updated	time.Time
+}
+
+// 按客户端地址限制请求频率, 保存在内存中, 服务重启后重新计数
+type RateLimiter struct {
+	Burst	int	// 每个周期内的请求次数上限
+	Per	time.Duration
+
+	mu	sync.Mutex
+	buckets	map[string]*bucket
+}
+
+func NewRateLimiter(burst int, per time.Duration) *RateLimiter {
+	return &RateLimiter{Burst: burst, Per: per, buckets: make(map[string]*bucket)}
+}
+
+// 消耗一次请求, 超出限制时返回 false 及需等待的时长
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(l.Burst) / l.Per.Seconds()	// 每秒恢复的次数
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= 10000 {
+			l.purge(now)
+		}
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// 清理已恢复满额的客户端, 调用方需持有锁
+func (l *RateLimiter) purge(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// 客户端地址; 部署在反向代理之后时取 X-Forwarded-For 中由代理追加的最后一项
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,87 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	// 每分钟 6 次, 即每 10 秒恢复一次
+	tests := []struct {
+		name	string
+		used	int	// 已连续请求的次数
+		elapsed	time.Duration	// 此后经过的时长
+		ok	bool
+		wait	time.Duration	// 被拒绝时的大致等待时长
+	}{
+		{"首次请求", 0, 0, true, 0},
+		{"用尽前的最后一次", 5, 0, true, 0},
+		{"用尽后立即请求", 6, 0, false, 10 * time.Second},
+		{"恢复不足一次", 6, 4 * time.Second, false, 6 * time.Second},
+		{"恢复一次", 6, 10 * time.Second, true, 0},
+		{"长时间空闲不超过上限", 6, time.Hour, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(6, time.Minute)
+			for i := 0; i < tt.used; i++ {
+				if ok, _ := l.Allow("1.2.3.4"); !ok {
+					t.Fatalf("第 %d 次请求被拒绝", i+1)
+				}
+			}
+			// 将上次请求的时间提前, 模拟经过的时长
+			if b, ok := l.buckets["1.2.3.4"]; ok {
+				b.updated = b.updated.Add(-tt.elapsed)
+			}
+
+			ok, wait := l.Allow("1.2.3.4")
+			if ok != tt.ok {
+				t.Fatalf("Allow() = %v, 应为 %v", ok, tt.ok)
+			}
+			if d := wait - tt.wait; d < -time.Second || d > time.Second {
+				t.Fatalf("等待时长为 %v, 应约为 %v", wait, tt.wait)
+			}
+			if ok {
+				// 每次只消耗一次, 恢复的次数不超过 Burst
+				if got := l.buckets["1.2.3.4"].tokens; got > float64(l.Burst-1)+0.01 {
+					t.Fatalf("剩余次数为 %v, 超过上限", got)
+				}
+			}
+
+			// 其他客户端不受影响
+			if ok, _ := l.Allow("5.6.7.8"); !ok {
+				t.Fatalf("其他客户端被拒绝")
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name	string
+		fwd	string
+		trust	bool
+		want	string
+	}{
+		{"直接连接", "", false, "10.0.0.1"},
+		{"不信任代理时忽略请求头", "1.1.1.1", false, "10.0.0.1"},
+		{"取代理追加的最后一项", "1.1.1.1, 2.2.2.2", true, "2.2.2.2"},
+		{"请求头为空", "", true, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: "10.0.0.1:5555", Header: http.Header{}}
+			if tt.fwd != "" {
+				r.Header.Set("X-Forwarded-For", tt.fwd)
+			}
+			if got := clientIP(r, tt.trust); got != tt.want {
+				t.Fatalf("clientIP() = %s, 应为 %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 生成学历证书电子注册备案表: 为信息的当前版本生成在线验证码后跳转至备案表
+func (app *Application) ReportCreate(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	user := currentUser(r)
+	edu, err := app.findEdu(r.FormValue("entityID"))
+	if err == nil && !canReport(user, edu) {
+		http.Error(w, "只能为本校的学历信息生成备案表", http.StatusForbidden)
+		return
+	}
+	if err == nil && edu.Revoked {
+		err = errors.New("该信息已撤销, 不能生成备案表")
+	}
+	if err == nil && len(edu.Historys) == 0 {
+		err = errors.New("未查询到信息对应的交易")
+	}
+
+	var v service.Verification
+	if err == nil {
+		// 备案表中包含全部信息, 在线验证时同样公开全部字段
+		v, err = app.Verifications.Create(edu, edu.Historys[len(edu.Historys)-1].TxId, user.LoginName, service.AllFields(), 0)
+	}
+	if err != nil {
+		http.Error(w, "生成备案表失败: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, "/report/"+v.Code, http.StatusSeeOther)
+}
+
+// 学历证书电子注册备案表, 内容为生成验证码时账本中的信息版本, 可直接打印
+func (app *Application) ReportView(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	v, ok := app.Verifications.Get(strings.TrimPrefix(r.URL.Path, "/report/"))
+	if !ok || !canReport(user, service.Education{SchoolName: v.SchoolName}) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := &struct {
+		Edu service.Education
+		Tx *service.TxInfo
+		Verification service.Verification
+		VerifyURL string
+		QRCode template.HTML
+		Changed bool	// 生成后信息已被修改
+		Revoked bool	// 生成后信息已被撤销
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		Verification:v,
+		VerifyURL:app.verifyURL(r, v.Code),
+		CurrentUser:user,
+		Msg:"",
+		Flag:false,
+	}
+
+	current, err := app.findEdu(v.EntityID)
+	if err != nil {
+		data.Msg = "查询账本中的信息失败: " + err.Error()
+		data.Flag = true
+		ShowView(w, r, "report.html", data)
+		return
+	}
+
+	// 取生成验证码时的信息版本
+	data.Edu = current
+	for _, item := range current.Historys {
+		if item.TxId == v.TxID {
+			data.Edu = item.Education
+		}
+	}
+	data.Edu.Historys = nil
+	data.Changed = len(current.Historys) > 0 && current.Historys[len(current.Historys)-1].TxId != v.TxID
+	data.Revoked = current.Revoked
+
+	if info, err := app.Setup.FindTxInfo(v.TxID); err == nil {
+		data.Tx = info
+	}
+
+	qr, err := service.EncodeQR(data.VerifyURL)
+	if err == nil {
+		data.QRCode = template.HTML(qr.SVG(3))
+	}
+
+	ShowView(w, r, "report.html", data)
+}
+
+// 审计员可为任意信息生成备案表, 登记员只能为本校的信息生成
+func canReport(user User, edu service.Education) bool {
+	return user.HasRole(service.RoleAuditor) || user.CanManage(edu.SchoolName)
+}
+
+// 根据身份证号查询信息及其历史记录
+func (app *Application) findEdu(entityID string) (service.Education, error) {
+	var edu = service.Education{}
+	result, err := app.Setup.FindEduInfoByEntityID(entityID)
+	if err == nil {
+		err = json.Unmarshal(result, &edu)
+	}
+	return edu, err
+}
+
+// 验证码对应的公开验证地址
+func (app *Application) verifyURL(r *http.Request, code string) string {
+	base := app.BaseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/verify/" + code
+}
@@ -0,0 +1,105 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 撤销信息确认页面, 指定了撤销失败的任务时以任务中的原因填充表单
+func (app *Application) RevokeShow(w http.ResponseWriter, r *http.Request) {
+	data := &struct {
+		Edu service.Education
+		Reason string
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		CurrentUser:currentUser(r),
+		Msg:"",
+		Flag:false,
+	}
+
+	entityID := r.FormValue("entityID")
+	if job, ok := app.failedJob(r, "revokeEdu"); ok {
+		entityID = job.Edu.EntityID
+		data.Reason = job.Reason
+		data.Msg = "信息撤销失败: " + job.Error
+		data.Flag = true
+	}
+
+	edu, err := app.revocable(r, entityID)
+	if err != nil {
+		data.Msg = err.Error()
+		data.Flag = true
+	}
+	data.Edu = edu
+
+	ShowView(w, r, "revoke.html", data)
+}
+
+// 撤销信息: 加入提交任务队列后跳转至任务状态页面
+func (app *Application) Revoke(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	user := currentUser(r)
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	edu, err := app.revocable(r, r.FormValue("entityID"))
+	if err == nil && reason == "" {
+		err = errors.New("请填写撤销原因")
+	}
+	if err == nil {
+		_, err = app.setupFor(user)
+	}
+
+	var job service.Job
+	if err == nil {
+		job, err = app.Jobs.Revoke(user.LoginName, edu, reason)
+	}
+	if err != nil {
+		data := &struct {
+			Edu service.Education
+			Reason string
+			CurrentUser User
+			Msg string
+			Flag bool
+		}{
+			Edu:edu,
+			Reason:reason,
+			CurrentUser:user,
+			Msg:"信息撤销失败: " + err.Error(),
+			Flag:true,
+		}
+		ShowView(w, r, "revoke.html", data)
+		return
+	}
+
+	http.Redirect(w, r, "/jobs/"+job.ID, http.StatusSeeOther)
+}
+
+// 查询可由当前用户撤销的信息: 只能撤销本校未撤销的学历信息
+func (app *Application) revocable(r *http.Request, entityID string) (service.Education, error) {
+	var edu = service.Education{}
+	result, err := app.Setup.FindEduInfoByEntityID(entityID)
+	if err == nil {
+		err = json.Unmarshal(result, &edu)
+	}
+	if err != nil {
+		return service.Education{}, err
+	}
+	if !currentUser(r).CanManage(edu.SchoolName) {
+		return service.Education{}, errors.New("只能撤销本校的学历信息")
+	}
+	if edu.Revoked {
+		return edu, errors.New("该信息已于 " + edu.RevokedAt + " 撤销")
+	}
+	return edu, nil
+}
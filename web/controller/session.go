@@ -0,0 +1,152 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 保存会话编号的 Cookie 名称
+const sessionCookie = "edu_session"
+
+// 服务端会话, 仅保存登录名, 每次请求时重新查找用户
+type session struct {
+	LoginName	string
+	Expires	time.Time
+}
+
+// 内存中的会话存储, 会话在闲置超过 TTL 后失效, 服务重启后所有会话失效
+type SessionStore struct {
+	TTL	time.Duration
+	Secure	bool	// Cookie 是否仅通过 HTTPS 发送
+
+	mu	sync.Mutex
+	sessions	map[string]*session
+}
+
+func NewSessionStore(ttl time.Duration, secure bool) *SessionStore {
+	return &SessionStore{TTL: ttl, Secure: secure, sessions: make(map[string]*session)}
+}
+
+// 创建会话并写入 Cookie, 每次登录均使用新的会话编号
+func (s *SessionStore) Create(w http.ResponseWriter, loginName string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.purge()
+	s.sessions[id] = &session{LoginName: loginName, Expires: time.Now().Add(s.TTL)}
+	s.mu.Unlock()
+
+	http.SetCookie(w, s.cookie(id, int(s.TTL.Seconds())))
+	return nil
+}
+
+// 根据请求中的 Cookie 查找会话对应的登录名, 有效的会话将被续期
+func (s *SessionStore) Get(r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[c.Value]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(sess.Expires) {
+		delete(s.sessions, c.Value)
+		return "", false
+	}
+
+	sess.Expires = time.Now().Add(s.TTL)
+	return sess.LoginName, true
+}
+
+// 删除会话并清除 Cookie
+func (s *SessionStore) Destroy(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, c.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, s.cookie("", -1))
+}
+
+// 删除指定用户的所有会话, 用于账号被停用或重置密码后强制重新登录
+func (s *SessionStore) DestroyUser(loginName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, sess := range s.sessions {
+		if sess.LoginName == loginName {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// 清理已过期的会话, 调用方需持有锁
+func (s *SessionStore) purge() {
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.After(sess.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (s *SessionStore) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name: sessionCookie,
+		Value: value,
+		Path: "/",
+		MaxAge: maxAge,
+		HttpOnly: true,
+		Secure: s.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+type contextKey int
+
+const userKey contextKey = 0
+
+// 当前请求的登录用户, 未登录时返回空用户
+func currentUser(r *http.Request) User {
+	if user, ok := r.Context().Value(userKey).(User); ok {
+		return user
+	}
+	return User{}
+}
+
+// 认证中间件: 未登录或会话已失效时转至登录页面, 否则将当前用户放入请求上下文
+func (app *Application) RequireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loginName, ok := app.Sessions.Get(r)
+		if !ok {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		user, ok := app.findUser(loginName)
+		if !ok {
+			app.Sessions.Destroy(w, r)
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	}
+}
@@ -2,7 +2,7 @@
   @Prject: goProjects
   @Dev_Software: GoLand
   @File : upload
-  @Time : 2018/10/24 11:58 
+  @Time : 2018/10/24 11:58
   @Author : hanxiaodong
 */
 
@@ -11,81 +11,83 @@ package controller
 import (
 	"fmt"
 	"net/http"
-	"io/ioutil"
-	"crypto/rand"
-	"path/filepath"
-	"os"
-	"mime"
+	"strings"
 	"log"
+	"github.com/kongyixueyuan.com/education/service"
 )
 
+// 上传照片的响应, 如 {"error": 0, "result": {"path": "...", ...}}, 失败时 error 为 1 且 result 中只有 msg
+type UploadResponse struct {
+	Error	int	`json:"error"`
+	Result	UploadResult	`json:"result"`
+}
+
+type UploadResult struct {
+	Msg	string	`json:"msg,omitempty"`
+	FileType	string	`json:"fileType,omitempty"`
+	Path	string	`json:"path,omitempty"`	// 重新编码后的照片
+	ThumbPath	string	`json:"thumbPath,omitempty"`	// 标准尺寸的证件照缩略图
+	FileName	string	`json:"fileName,omitempty"`
+	Width	int	`json:"width,omitempty"`
+	Height	int	`json:"height,omitempty"`
+	Size	int	`json:"size,omitempty"`
+}
 
+// 上传照片: 校验并重新编码后按内容摘要保存, 同时生成证件照缩略图
 func (app *Application) UploadFile(w http.ResponseWriter, r *http.Request)  {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		uploadError(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+		return
+	}
 
-	start := "{"
-	content := ""
-	end := "}"
+	// 限制整个请求体的大小, 为表单的其他内容预留 64KB
+	limit := app.Photos.MaxSize + 64<<10
+	if r.ContentLength > limit {
+		uploadError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("照片不能超过 %d KB", app.Photos.MaxSize>>10))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
 
 	file, _, err := r.FormFile("file")
 	if err != nil {
-		content = "\"error\":1,\"result\":{\"msg\":\"指定了无效的文件\",\"path\":\"\"}"
-		w.Write([]byte(start + content + end))
+		uploadError(w, http.StatusBadRequest, "指定了无效的文件")
 		return
 	}
 	defer file.Close()
 
-	fileBytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		content = "\"error\":1,\"result\":{\"msg\":\"无法读取文件内容\",\"path\":\"\"}"
-		w.Write([]byte(start + content + end))
+	photo, err := app.Photos.Process(file)
+	switch {
+	case err == service.ErrPhotoTooLarge:
+		uploadError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("照片不能超过 %d KB", app.Photos.MaxSize>>10))
 		return
-	}
-
-	filetype := http.DetectContentType(fileBytes)
-	//log.Println("filetype = " + filetype)
-	switch filetype {
-	case "image/jpeg", "image/jpg":
-	case "image/gif", "image/png":
-	case "application/pdf":
-		break
-	default:
-		content = "\"error\":1,\"result\":{\"msg\":\"文件类型错误\",\"path\":\"\"}"
-		w.Write([]byte(start + content + end))
+	case err == service.ErrPhotoType:
+		uploadError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
-	}
-
-	fileName := randToken(12)	// 指定文件名
-	fileEndings, err := mime.ExtensionsByType(filetype)	// 获取文件扩展名
-	//log.Println("fileEndings = " + fileEndings[0])
-	// 指定文件存储路径
-	newPath := filepath.Join("web", "static", "photo", fileName + fileEndings[0])
-	//fmt.Printf("FileType: %s, File: %s\n", filetype, newPath)
-
-	newFile, err := os.Create(newPath)
-	if err != nil {
-		log.Println("创建文件失败：" + err.Error())
-		content = "\"error\":1,\"result\":{\"msg\":\"创建文件失败\",\"path\":\"\"}"
-		w.Write([]byte(start + content + end))
+	case err != nil:
+		uploadError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer newFile.Close()
 
-	if _, err := newFile.Write(fileBytes); err != nil || newFile.Close() != nil {
-		log.Println("写入文件失败：" + err.Error())
-		content = "\"error\":1,\"result\":{\"msg\":\"保存文件内容失败\",\"path\":\"\"}"
-		w.Write([]byte(start + content + end))
+	path, thumbPath, err := app.Attachments.SavePhoto(photo)
+	if err != nil {
+		log.Println("保存照片失败：" + err.Error())
+		uploadError(w, http.StatusInternalServerError, "保存文件内容失败")
 		return
 	}
 
-	path := "/static/photo/" + fileName + fileEndings[0]
-	content = "\"error\":0,\"result\":{\"fileType\":\"image/png\",\"path\":\"" + path + "\",\"fileName\":\"ce73ac68d0d93de80d925b5a.png\"}"
-	w.Write([]byte(start + content + end))
-	return
+	writeJSON(w, http.StatusOK, UploadResponse{Result: UploadResult{
+		FileType: photo.ContentType,
+		Path: path,
+		ThumbPath: thumbPath,
+		FileName: strings.TrimPrefix(path, service.PhotoURLPrefix) + photo.Ext,
+		Width: photo.Width,
+		Height: photo.Height,
+		Size: len(photo.Data),
+	}})
 }
 
-func randToken(len int) string {
-	b := make([]byte, len)
-	rand.Read(b)
-	return fmt.Sprintf("%x", b)
+func uploadError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, UploadResponse{Error: 1, Result: UploadResult{Msg: msg}})
 }
 
@@ -0,0 +1,199 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"net/http"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 首次运行: 尚无任何账号时创建初始管理员, 之后该页面不可用
+func (app *Application) FirstRun(w http.ResponseWriter, r *http.Request) {
+	if !app.Users.Empty() {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	data := &struct {
+		LoginName string
+		MinLength int
+		Msg string
+		Flag bool
+	}{
+		MinLength:service.MinPasswordLength,
+	}
+
+	if r.Method != http.MethodPost {
+		ShowView(w, r, "setup.html", data)
+		return
+	}
+
+	data.LoginName = r.FormValue("loginName")
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		data.Msg = "两次输入的密码不一致"
+		data.Flag = true
+		ShowView(w, r, "setup.html", data)
+		return
+	}
+
+	err := app.Users.CreateInitialAdmin(data.LoginName, password)
+	if err != nil {
+		data.Msg = err.Error()
+		data.Flag = true
+		ShowView(w, r, "setup.html", data)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// 用户管理: 创建、停用、重置密码及分配角色
+func (app *Application) UsersView(w http.ResponseWriter, r *http.Request) {
+	app.showUsers(w, r, "", false)
+}
+
+// 创建账号
+func (app *Application) UserCreate(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	r.ParseForm()
+	loginName := r.FormValue("loginName")
+	err := app.Users.Create(loginName, r.FormValue("password"), r.Form["roles"], r.FormValue("school"), r.FormValue("entityID"))
+	if err != nil {
+		app.showUsers(w, r, err.Error(), true)
+		return
+	}
+	app.showUsers(w, r, "已创建账号 "+loginName, false)
+}
+
+// 停用或启用账号, 停用后该账号的会话立即失效
+func (app *Application) UserDisable(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	loginName := r.FormValue("loginName")
+	disabled := r.FormValue("disabled") == "true"
+	if disabled && loginName == currentUser(r).LoginName {
+		app.showUsers(w, r, "不能停用自己的账号", true)
+		return
+	}
+
+	err := app.Users.SetDisabled(loginName, disabled)
+	if err != nil {
+		app.showUsers(w, r, err.Error(), true)
+		return
+	}
+
+	if disabled {
+		app.Sessions.DestroyUser(loginName)
+		app.showUsers(w, r, "已停用账号 "+loginName, false)
+		return
+	}
+	app.showUsers(w, r, "已启用账号 "+loginName, false)
+}
+
+// 重置账号密码, 该账号需使用新密码重新登录
+func (app *Application) UserResetPassword(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	loginName := r.FormValue("loginName")
+	err := app.Users.SetPassword(loginName, r.FormValue("password"))
+	if err != nil {
+		app.showUsers(w, r, err.Error(), true)
+		return
+	}
+
+	if loginName != currentUser(r).LoginName {
+		app.Sessions.DestroyUser(loginName)
+	}
+	app.showUsers(w, r, "已重置账号 "+loginName+" 的密码", false)
+}
+
+// 设置账号的角色、所属学校及持证人的身份证号
+func (app *Application) UserRoles(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	r.ParseForm()
+	loginName := r.FormValue("loginName")
+	err := app.Users.SetRoles(loginName, r.Form["roles"], r.FormValue("school"), r.FormValue("entityID"))
+	if err != nil {
+		app.showUsers(w, r, err.Error(), true)
+		return
+	}
+	app.showUsers(w, r, "已更新账号 "+loginName+" 的角色", false)
+}
+
+func (app *Application) showUsers(w http.ResponseWriter, r *http.Request, msg string, failed bool) {
+	data := &struct {
+		Accounts []service.Account
+		Roles []string
+		MinLength int
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		Accounts:app.Users.List(),
+		Roles:service.Roles,
+		MinLength:service.MinPasswordLength,
+		CurrentUser:currentUser(r),
+		Msg:msg,
+		Flag:failed,
+	}
+	ShowView(w, r, "users.html", data)
+}
+
+// 修改当前用户的密码
+func (app *Application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	data := &struct {
+		MinLength int
+		CurrentUser User
+		Msg string
+		Flag bool
+	}{
+		MinLength:service.MinPasswordLength,
+		CurrentUser:currentUser(r),
+	}
+
+	if r.Method != http.MethodPost {
+		ShowView(w, r, "password.html", data)
+		return
+	}
+
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		data.Msg = "两次输入的新密码不一致"
+		data.Flag = true
+		ShowView(w, r, "password.html", data)
+		return
+	}
+
+	err := app.Users.ChangePassword(data.CurrentUser.LoginName, r.FormValue("oldPassword"), password)
+	if err != nil {
+		data.Msg = err.Error()
+		data.Flag = true
+		ShowView(w, r, "password.html", data)
+		return
+	}
+
+	data.Msg = "密码修改成功"
+	ShowView(w, r, "password.html", data)
+}
+
+// 仅接受 POST 请求
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "请求方法不正确", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
@@ -8,27 +8,48 @@ import "github.com/kongyixueyuan.com/education/service"
 
 type Application struct {
 	Setup *service.ServiceSetup
+	Network *service.NetworkSetup
+	Identities *service.IdentitySetup
+	Sessions *SessionStore
+	Users *service.UserStore
+	APIKeys *service.APIKeyStore
+	Tokens *service.TokenIssuer
+	Jobs *service.JobQueue
+	Photos *service.PhotoProcessor
+	Attachments *service.Attachments
+	Verifications *service.VerificationStore
+	VerifyLog *service.VerifyLog
+	VerifyLimiter *RateLimiter	// 公开验证页面按客户端地址限制查询频率
+	TrustProxy bool	// 是否根据 X-Forwarded-For 确定客户端地址
+	BaseURL string	// 验证页面的公开访问地址, 为空时使用请求的地址
+	Credentials *service.Credentials	// 签发及核验可验证凭证
 }
 
+// 当前登录的用户, 供模板使用
 type User struct {
 	LoginName	string
-	Password	string
-	IsAdmin	string
+	Roles	[]string
+	School	string
+	EntityID	string	// 持证人本人的身份证号
 }
 
+func newUser(account service.Account) User {
+	return User{LoginName: account.LoginName, Roles: account.Roles, School: account.School, EntityID: account.EntityID}
+}
 
-var users []User
-
-func init() {
-
-	admin := User{LoginName:"Hanxiaodong", Password:"123456", IsAdmin:"T"}
-	alice := User{LoginName:"ChainDesk", Password:"123456", IsAdmin:"T"}
-	bob := User{LoginName:"alice", Password:"123456", IsAdmin:"F"}
-	jack := User{LoginName:"bob", Password:"123456", IsAdmin:"F"}
-
-	users = append(users, admin)
-	users = append(users, alice)
-	users = append(users, bob)
-	users = append(users, jack)
+// 根据登录名查找用户, 已停用的账号视为不存在
+func (app *Application) findUser(loginName string) (User, bool) {
+	account, ok := app.Users.Get(loginName)
+	if !ok || account.Disabled {
+		return User{}, false
+	}
+	return newUser(account), true
+}
 
-}
\ No newline at end of file
+// 当前用户提交交易时使用的 ServiceSetup, 已登记 Fabric 身份的账号使用各自的身份签名
+func (app *Application) setupFor(user User) (*service.ServiceSetup, error) {
+	if app.Identities == nil {
+		return app.Setup, nil
+	}
+	return app.Identities.SetupFor(user.LoginName)
+}
@@ -0,0 +1,226 @@
+/**
+  @Author : hanxiaodong
+*/
+
+package controller
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/kongyixueyuan.com/education/service"
+)
+
+// 验证结果的状态
+const (
+	verifyActive = "active"	// 信息有效
+	verifyRevoked = "revoked"	// 信息已被撤销
+	verifyExpired = "expired"	// 验证码已过期或已被持证人作废
+)
+
+// 公开验证的结果, 只包含持证人选择公开的字段
+type VerifyResult struct {
+	Code	string	`json:"code"`
+	Status	string	`json:"status"`	// active、revoked 或 expired, 过期时不返回其他信息
+	SchoolName	string	`json:"schoolName,omitempty"`	// 发证学校
+	Fields	[]DisclosedField	`json:"fields,omitempty"`
+	TxID	string	`json:"txID,omitempty"`	// 生成验证码时信息的交易编号
+	Superseded	bool	`json:"superseded,omitempty"`	// 生成验证码后信息已被修改, 公开的为生成时的版本
+	RevokedAt	string	`json:"revokedAt,omitempty"`
+	IssuedAt	time.Time	`json:"issuedAt"`
+	ExpiresAt	time.Time	`json:"expiresAt"`
+}
+
+type DisclosedField struct {
+	Name	string	`json:"name"`
+	Label	string	`json:"label"`
+	Value	string	`json:"value"`	// 照片为图片地址, 仅在信息有效时提供
+}
+
+// 查询失败, 包含返回的状态码及 API 错误码
+type verifyError struct {
+	status	int
+	code	string
+	msg	string
+}
+
+func (e *verifyError) Error() string {
+	return e.msg
+}
+
+// GET /verify/ 输入验证码; GET /verify/<验证码> 验证结果页面; GET /verify/<验证码>/photo 公开的照片
+// 无需登录, 每次查询均记录日志并按客户端地址限制频率
+func (app *Application) VerifyPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "请求方法不正确", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/verify/")
+	if code == "" {
+		if code = strings.TrimSpace(r.FormValue("code")); code != "" {
+			http.Redirect(w, r, "/verify/"+url.PathEscape(code), http.StatusSeeOther)
+			return
+		}
+		ShowView(w, r, "verify.html", &struct {
+			Result *VerifyResult
+			Msg string
+			Flag bool
+		}{})
+		return
+	}
+
+	if strings.HasSuffix(code, "/photo") {
+		app.verifyPhoto(w, r, strings.TrimSuffix(code, "/photo"))
+		return
+	}
+
+	data := &struct {
+		Result *VerifyResult
+		Msg string
+		Flag bool
+	}{}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	result, _, err := app.resolveCode(w, r, code, "page")
+	if err != nil {
+		w.WriteHeader(err.(*verifyError).status)
+		data.Msg = err.Error()
+		data.Flag = true
+	} else {
+		data.Result = &result
+	}
+	ShowView(w, r, "verify.html", data)
+}
+
+// GET /api/v1/verify/<验证码>: 以 JSON 返回验证结果, 无需认证
+func (app *Application) VerifyAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "不支持的请求方法: "+r.Method)
+		return
+	}
+
+	result, _, err := app.resolveCode(w, r, strings.TrimPrefix(r.URL.Path, "/api/v1/verify/"), "api")
+	if err != nil {
+		e := err.(*verifyError)
+		writeAPIError(w, e.status, e.code, e.msg)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, result)
+}
+
+// 持证人选择公开照片且信息有效时返回照片
+func (app *Application) verifyPhoto(w http.ResponseWriter, r *http.Request, code string) {
+	result, edu, err := app.resolveCode(w, r, code, "photo")
+	if err != nil {
+		http.Error(w, err.Error(), err.(*verifyError).status)
+		return
+	}
+	var disclosed bool
+	for _, f := range result.Fields {
+		disclosed = disclosed || (f.Name == "Photo" && f.Value != "")
+	}
+	if !disclosed {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := app.loadPhoto(edu.Photo)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	servePhoto(w, r, data, time.Time{})
+}
+
+// 解析验证码并查询账本, 返回验证结果及生成验证码时的信息版本
+func (app *Application) resolveCode(w http.ResponseWriter, r *http.Request, code, via string) (VerifyResult, service.Education, error) {
+	lookup := service.VerifyLookup{Via: via, Code: code}
+	defer app.recordLookup(&lookup)
+	if err := app.allowLookup(w, r, &lookup); err != nil {
+		return VerifyResult{}, service.Education{}, err
+	}
+
+	v, ok := app.Verifications.Get(code)
+	if !ok {
+		lookup.Result = "not_found"
+		return VerifyResult{}, service.Education{}, &verifyError{http.StatusNotFound, "not_found", "验证码不存在, 请核对后重新输入"}
+	}
+	lookup.EntityID = v.EntityID
+
+	result := VerifyResult{Code: v.Code, Status: verifyExpired, IssuedAt: v.CreatedAt, ExpiresAt: v.ExpiresAt}
+	if !v.Valid() {
+		lookup.Result = verifyExpired
+		return result, service.Education{}, nil
+	}
+
+	current, err := app.findEdu(v.EntityID)
+	if service.IsNotFound(err) {
+		lookup.Result = "not_found"
+		return VerifyResult{}, service.Education{}, &verifyError{http.StatusNotFound, "not_found", "验证码对应的学历信息已不存在"}
+	}
+	if err != nil {
+		lookup.Result = "error"
+		log.Println("验证时查询账本失败: " + err.Error())
+		return VerifyResult{}, service.Education{}, &verifyError{http.StatusBadGateway, "ledger_error", "查询账本失败, 请稍后再试"}
+	}
+
+	// 公开生成验证码时的信息版本, 状态以账本中的当前信息为准
+	edu := current
+	for _, item := range current.Historys {
+		if item.TxId == v.TxID {
+			edu = item.Education
+		}
+	}
+
+	result.Status = verifyActive
+	if current.Revoked {
+		result.Status = verifyRevoked
+		result.RevokedAt = current.RevokedAt
+	}
+	result.SchoolName = edu.SchoolName
+	result.TxID = v.TxID
+	result.Superseded = len(current.Historys) > 0 && current.Historys[len(current.Historys)-1].TxId != v.TxID
+
+	for _, name := range v.Fields {
+		value := edu.Field(name)
+		if name == "Photo" {
+			value = ""
+			if result.Status == verifyActive && edu.Photo != "" {
+				value = app.verifyURL(r, v.Code) + "/photo"
+			}
+		}
+		result.Fields = append(result.Fields, DisclosedField{Name: name, Label: service.FieldLabel(name), Value: value})
+	}
+
+	lookup.Result = result.Status
+	return result, edu, nil
+}
+
+// 按客户端地址限制查询频率, 超出限制时返回错误并设置 Retry-After
+func (app *Application) allowLookup(w http.ResponseWriter, r *http.Request, lookup *service.VerifyLookup) error {
+	lookup.IP = clientIP(r, app.TrustProxy)
+	lookup.UserAgent = r.UserAgent()
+
+	ok, wait := app.VerifyLimiter.Allow(lookup.IP)
+	if ok {
+		return nil
+	}
+	lookup.Result = "rate_limited"
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return &verifyError{http.StatusTooManyRequests, "rate_limited", "查询过于频繁, 请稍后再试"}
+}
+
+// 记录一次公开查询
+func (app *Application) recordLookup(lookup *service.VerifyLookup) {
+	if err := app.VerifyLog.Record(*lookup); err != nil {
+		log.Println(err)
+	}
+}
@@ -8,40 +8,113 @@ import (
 	"net/http"
 	"fmt"
 	"github.com/kongyixueyuan.com/education/web/controller"
+	"github.com/kongyixueyuan.com/education/conf"
+	"github.com/kongyixueyuan.com/education/service"
 )
 
 
 // 启动Web服务并指定路由信息
-func WebStart(app controller.Application)  {
+func WebStart(app controller.Application, cfg conf.WebConfig)  {
 
-	fs:= http.FileServer(http.Dir("web/static"))
+	controller.TplDir = cfg.TplDir
+	controller.StaticDir = cfg.StaticDir
+
+	fs:= http.FileServer(http.Dir(cfg.StaticDir))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 
+	app.Sessions = controller.NewSessionStore(cfg.SessionTTL, cfg.SecureCookie)
+
+	const (
+		registrar = service.RoleRegistrar
+		auditor = service.RoleAuditor
+		verifier = service.RoleVerifier
+		admin = service.RoleAdmin
+		holder = service.RoleHolder
+	)
+
 	// 指定路由信息(匹配请求)
+	// 登录相关页面无需登录, 其余页面登录后方可访问, 并需具有所列角色之一(未列出角色时所有登录用户均可访问)
 	http.HandleFunc("/", app.LoginView)
 	http.HandleFunc("/login", app.Login)
 	http.HandleFunc("/loginout", app.LoginOut)
-
-	http.HandleFunc("/index", app.Index)
-	http.HandleFunc("/help", app.Help)
-
-	http.HandleFunc("/addEduInfo", app.AddEduShow)	// 显示添加信息页面
-	http.HandleFunc("/addEdu", app.AddEdu)	// 提交信息请求
-
-	http.HandleFunc("/queryPage", app.QueryPage)	// 转至根据证书编号与姓名查询信息页面
-	http.HandleFunc("/query", app.FindCertByNoAndName)	// 根据证书编号与姓名查询信息
-
-	http.HandleFunc("/queryPage2", app.QueryPage2)	// 转至根据身份证号码查询信息页面
-	http.HandleFunc("/query2", app.FindByID)	// 根据身份证号码查询信息
-
-
-	http.HandleFunc("/modifyPage", app.ModifyShow)	// 修改信息页面
-	http.HandleFunc("/modify", app.Modify)	//  修改信息
-
-	http.HandleFunc("/upload", app.UploadFile)
-
-	fmt.Println("启动Web服务, 监听端口号为: 9000")
-	err := http.ListenAndServe(":9000", nil)
+	http.HandleFunc("/setup", app.FirstRun)	// 首次运行时创建管理员
+	http.HandleFunc("/verify/", app.VerifyPage)	// 公开的在线验证页面, 按客户端地址限制查询频率
+	http.HandleFunc("/verify/disclosure", app.DisclosurePage)	// 公开的披露包核验页面
+
+	app.Handle("/index", app.Index)
+	app.Handle("/help", app.Help)
+	app.Handle("/password", app.ChangePassword)	// 修改密码
+
+	app.Handle("/addEduInfo", app.AddEduShow, registrar)	// 显示添加信息页面
+	app.Handle("/addEdu", app.AddEdu, registrar)	// 提交信息请求
+
+	app.Handle("/queryPage", app.QueryPage, registrar, auditor, verifier)	// 转至根据证书编号与姓名查询信息页面
+	app.Handle("/query", app.FindCertByNoAndName, registrar, auditor, verifier)	// 根据证书编号与姓名查询信息
+
+	app.Handle("/queryPage2", app.QueryPage2, registrar, auditor)	// 转至根据身份证号码查询信息页面
+	app.Handle("/query2", app.FindByID, registrar, auditor)	// 根据身份证号码查询信息(含历史记录)
+
+
+	app.Handle("/modifyPage", app.ModifyShow, registrar)	// 修改信息页面
+	app.Handle("/modify", app.Modify, registrar)	//  修改信息
+	app.Handle("/revokePage", app.RevokeShow, registrar)	// 撤销信息确认页面
+	app.Handle("/revoke", app.Revoke, registrar)	// 撤销信息
+	app.Handle("/photos/", app.PhotoView, registrar, auditor, verifier)	// 照片及缩略图
+	app.Handle("/static/photo/", app.LegacyPhotoView, registrar, auditor, verifier)	// 旧版本上传的照片
+
+	app.Handle("/upload", app.UploadFile, registrar)
+
+	app.Handle("/jobs", app.JobsView, registrar)	// 我的提交
+	app.Handle("/jobs/", app.JobDetail, registrar)	// 提交任务状态
+
+	app.Handle("/tx/", app.TxDetail, registrar, auditor)	// 根据交易编号查看交易详情(非本校信息已脱敏)
+
+	app.Handle("/report", app.ReportCreate, registrar, auditor)	// 生成学历证书电子注册备案表
+	app.Handle("/report/", app.ReportView, registrar, auditor)	// 打印学历证书电子注册备案表
+
+	app.Handle("/my", app.HolderView, holder)	// 本人学历信息及在线验证码
+	app.Handle("/my/share", app.HolderShare, holder)	// 生成在线验证码
+	app.Handle("/my/withdraw", app.HolderWithdraw, holder)	// 作废在线验证码
+	app.Handle("/my/disclosure", app.HolderDisclosure, holder)	// 下载披露包
+	app.Handle("/my/credential", app.HolderCredential, holder)	// 下载可验证凭证
+
+	app.Handle("/explorer", app.Explorer, auditor, admin)	// 区块浏览
+	app.Handle("/explorer/block/", app.ExplorerBlock, auditor, admin)	// 区块详情
+	app.Handle("/explorer/search", app.ExplorerSearch, auditor, admin)	// 根据交易编号或区块号搜索
+	app.Handle("/explorer/tx/", app.ExplorerTx, auditor, admin)	// 交易详情(个人信息已脱敏)
+
+	app.Handle("/admin/network", app.NetworkView, admin)	// 网络管理
+	app.Handle("/admin/users", app.UsersView, admin)	// 用户管理
+	app.Handle("/admin/users/create", app.UserCreate, admin)	// 创建账号
+	app.Handle("/admin/users/disable", app.UserDisable, admin)	// 停用或启用账号
+	app.Handle("/admin/users/reset", app.UserResetPassword, admin)	// 重置密码
+	app.Handle("/admin/users/roles", app.UserRoles, admin)	// 分配角色
+	app.Handle("/admin/apikeys", app.APIKeysView, admin)	// API 密钥管理
+	app.Handle("/admin/apikeys/create", app.APIKeyCreate, admin)	// 创建 API 密钥
+	app.Handle("/admin/apikeys/revoke", app.APIKeyRevoke, admin)	// 吊销 API 密钥
+	app.Handle("/admin/identities", app.IdentitiesView, admin)	// 身份管理
+	app.Handle("/admin/identities/enroll", app.IdentityEnroll, admin)	// 为账号注册 Fabric 身份
+	app.Handle("/admin/identities/revoke", app.IdentityRevoke, admin)	// 吊销账号的 Fabric 身份
+
+	// REST API, 以 JSON 格式请求及响应
+	// 调用方可使用浏览器会话、API 密钥(Authorization: ApiKey <密钥>)或由密钥换取的访问令牌(Authorization: Bearer <令牌>)
+	api := app.NewAPIRouter()
+	api.Handle("GET", "/api/v1/educations", app.APIFindEdu, registrar, auditor, verifier)	// 根据证书编号与姓名查询
+	api.Handle("POST", "/api/v1/educations", app.APICreateEdu, registrar)	// 添加信息
+	api.Handle("GET", "/api/v1/educations/{entityID}", app.APIGetEdu, registrar, auditor)	// 根据身份证号查询
+	api.Handle("PUT", "/api/v1/educations/{entityID}", app.APIUpdateEdu, registrar)	// 修改信息
+	api.Handle("DELETE", "/api/v1/educations/{entityID}", app.APIRevokeEdu, registrar)	// 撤销信息
+	api.Handle("GET", "/api/v1/educations/{entityID}/history", app.APIEduHistory, registrar, auditor)	// 历史记录
+	api.Handle("GET", "/api/v1/educations/{entityID}/credential", app.APIEduCredential, registrar, auditor)	// 签发可验证凭证
+	http.Handle("/api/", api)
+	http.HandleFunc("/api/v1/token", app.APIToken)	// 使用 API 密钥换取访问令牌
+	http.HandleFunc("/api/v1/openapi.yaml", app.OpenAPI)	// API 文档
+	http.HandleFunc("/api/v1/verify/", app.VerifyAPI)	// 公开的在线验证, 无需认证
+	http.HandleFunc("/api/v1/disclosures/verify", app.DisclosureAPI)	// 公开的披露包核验, 无需认证
+	http.HandleFunc("/api/v1/credentials/verify", app.CredentialVerifyAPI)	// 公开的可验证凭证核验, 无需认证
+
+	fmt.Println("启动Web服务, 监听地址为: " + cfg.Addr)
+	err := http.ListenAndServe(cfg.Addr, nil)
 	if err != nil {
 		fmt.Printf("Web服务启动失败: %v", err)
 	}